@@ -5,6 +5,10 @@
 // Command gocmd is used for debugging the invoke.Go function.
 // The output from stdout, stderr and the standard log is redirected to stdout,
 // and each line is printed with a prefix indicating the origin.
+//
+// When the -record flag is set, the invocation is also recorded in the named
+// transcript file.  When the -replay flag is set, the invocation is served
+// from the named transcript file, instead of running the go command.
 package main
 
 import (
@@ -16,10 +20,13 @@ import (
 
 	"github.com/perillo/gocmd/internal/debug"
 	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
 )
 
 var (
 	debugging = flag.Bool("debug", false, "enable debugging")
+	record    = flag.String("record", "", "record the invocation in the transcript `file`")
+	replay    = flag.String("replay", "", "replay the invocation from the transcript `file`")
 )
 
 var (
@@ -43,12 +50,31 @@ func main() {
 		stderr = debug.Stderr
 	}
 
+	if *record != "" {
+		// Set the GOCMDRECORD environment variable to enable recording.
+		os.Setenv("GOCMDRECORD", *record)
+	}
+
+	var attr invoke.Attr
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r, err := runner.NewReplayer(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		attr.Runner = r
+	}
+
 	// check command line arguments.
 	if flag.NArg() == 0 {
 		return
 	}
 
-	data, err := invoke.Go(flag.Arg(0), flag.Args()[1:], nil)
+	data, err := invoke.Go(flag.Arg(0), flag.Args()[1:], &attr)
 	if err != nil {
 		fmt.Fprint(stderr, err)
 	}
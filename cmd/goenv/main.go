@@ -0,0 +1,77 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command goenv is used for debugging the env package.  It prints a table
+// with the effective value, the default value and the source of each Go
+// environment variable.
+//
+// When the -changed flag is set, only the variables whose effective value
+// differs from the default value are printed, as with go env -changed.
+//
+// When the -debug flag is set, the output from stdout, stderr and the standard
+// log is redirected to stdout, and each line is printed with a prefix
+// indicating the origin.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/perillo/gocmd/env"
+	"github.com/perillo/gocmd/internal/debug"
+)
+
+var (
+	changed   = flag.Bool("changed", false, "only print the changed variables")
+	debugging = flag.Bool("debug", false, "enable debugging")
+)
+
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	if *debugging {
+		// Set the GOCMDDEBUG environment variable to debug some corner cases.
+		os.Setenv("GOCMDDEBUG", "on")
+
+		// Initialize the debug environment.
+		if err := debug.Init(); err != nil {
+			log.Fatal(err)
+		}
+		stdout = debug.Stdout
+		stderr = debug.Stderr
+	}
+
+	vars, err := env.Vars()
+	if err != nil {
+		fmt.Fprint(stderr, err)
+		os.Exit(1)
+	}
+	if *changed {
+		vars = env.Changed(vars)
+	}
+
+	// Print the table.
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tDEFAULT\tSOURCE\t")
+	for _, v := range vars {
+		mark := ""
+		if v.Changed() {
+			mark = " *"
+		}
+		fmt.Fprintf(w, "%s%s\t%q\t%q\t%v\t\n", v.Name, mark, v.Value, v.Default, v.Source)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -6,12 +6,15 @@
 package env
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
 )
 
 // Config is used to provide custom options for accessing the Go environment.
@@ -19,6 +22,14 @@ type Config struct {
 	// Path is the path in which the Go environment configuration file is
 	// stored.  If not specified, $GOENV will be used.
 	Path string
+
+	// Runner is the runner used to run the go env command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go env command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
 }
 
 // Get returns the entire Go environment as a map.
@@ -27,10 +38,15 @@ type Config struct {
 // variable.  If a variable does not exists, the associated value will be the
 // empty string.
 func (c *Config) Get(vars ...string) (map[string]string, error) {
+	return c.GetContext(context.Background(), vars...)
+}
+
+// GetContext is like Get but includes a context.
+func (c *Config) GetContext(ctx context.Context, vars ...string) (map[string]string, error) {
 	argv := []string{"-json"}
 	argv = append(argv, vars...)
 
-	stdout, err := c.invokeGo(argv)
+	stdout, err := c.invokeGo(ctx, argv)
 	if err != nil {
 		return nil, fmt.Errorf("env: read: %w", err)
 	}
@@ -47,10 +63,15 @@ func (c *Config) Get(vars ...string) (map[string]string, error) {
 //
 // If one or more variables does not exist, Set returns an error.
 func (c *Config) Set(env map[string]string) error {
+	return c.SetContext(context.Background(), env)
+}
+
+// SetContext is like Set but includes a context.
+func (c *Config) SetContext(ctx context.Context, env map[string]string) error {
 	argv := []string{"-w"}
 	argv = append(argv, flatenv(env)...)
 
-	_, err := c.invokeGo(argv)
+	_, err := c.invokeGo(ctx, argv)
 	if err != nil {
 		return fmt.Errorf("env: write: %w", err)
 	}
@@ -63,10 +84,15 @@ func (c *Config) Set(env map[string]string) error {
 //
 // If one or more variables does not exist, Unset returns an error.
 func (c *Config) Unset(vars ...string) error {
+	return c.UnsetContext(context.Background(), vars...)
+}
+
+// UnsetContext is like Unset but includes a context.
+func (c *Config) UnsetContext(ctx context.Context, vars ...string) error {
 	argv := []string{"-u"}
 	argv = append(argv, vars...)
 
-	_, err := c.invokeGo(argv)
+	_, err := c.invokeGo(ctx, argv)
 	if err != nil {
 		return fmt.Errorf("env: unset %q: %w", vars, err)
 	}
@@ -78,9 +104,14 @@ func (c *Config) Unset(vars ...string) error {
 //
 // If key does not exist, Getenv returns an empty string.
 func (c *Config) Getenv(key string) (string, error) {
+	return c.GetenvContext(context.Background(), key)
+}
+
+// GetenvContext is like Getenv but includes a context.
+func (c *Config) GetenvContext(ctx context.Context, key string) (string, error) {
 	argv := []string{key}
 
-	stdout, err := c.invokeGo(argv)
+	stdout, err := c.invokeGo(ctx, argv)
 	if err != nil {
 		return "", fmt.Errorf("env: getenv %q: %w", key, err)
 	}
@@ -93,9 +124,14 @@ func (c *Config) Getenv(key string) (string, error) {
 //
 // If key does not exist, Setenv returns an error.
 func (c *Config) Setenv(key, value string) error {
+	return c.SetenvContext(context.Background(), key, value)
+}
+
+// SetenvContext is like Setenv but includes a context.
+func (c *Config) SetenvContext(ctx context.Context, key, value string) error {
 	argv := []string{"-w", key + "=" + value}
 
-	_, err := c.invokeGo(argv)
+	_, err := c.invokeGo(ctx, argv)
 	if err != nil {
 		return fmt.Errorf("env: setenv \"%s=%s\": %w", key, value, err)
 	}
@@ -108,9 +144,14 @@ func (c *Config) Setenv(key, value string) error {
 //
 // If key does not exist, Unsetenv returns an error.
 func (c *Config) Unsetenv(key string) error {
+	return c.UnsetenvContext(context.Background(), key)
+}
+
+// UnsetenvContext is like Unsetenv but includes a context.
+func (c *Config) UnsetenvContext(ctx context.Context, key string) error {
 	argv := []string{"-u", key}
 
-	_, err := c.invokeGo(argv)
+	_, err := c.invokeGo(ctx, argv)
 	if err != nil {
 		return fmt.Errorf("env: unsetenv %q: %w", key, err)
 	}
@@ -118,15 +159,16 @@ func (c *Config) Unsetenv(key string) error {
 	return nil
 }
 
-func (c *Config) invokeGo(argv []string) ([]byte, error) {
-	if c.Path == "" {
-		return invoke.Go("env", argv, nil)
-	}
+func (c *Config) invokeGo(ctx context.Context, argv []string) ([]byte, error) {
 	attr := invoke.Attr{
-		Env: append(os.Environ(), "GOENV="+c.Path),
+		Runner:    c.Runner,
+		Toolchain: c.Toolchain,
+	}
+	if c.Path != "" {
+		attr.Env = append(os.Environ(), "GOENV="+c.Path)
 	}
 
-	return invoke.Go("env", argv, &attr)
+	return invoke.GoContext(ctx, "env", argv, &attr)
 }
 
 // Get returns the entire Go environment as a map, using the default
@@ -5,11 +5,14 @@
 package env_test // in order to avoid import cycle
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/perillo/gocmd/env"
 	"github.com/perillo/gocmd/internal/envtest"
+	"github.com/perillo/gocmd/toolchain"
 )
 
 // TestSet tests the Set, Get and Unset functions.
@@ -140,7 +143,7 @@ func TestGetUnknown(t *testing.T) {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("get: got %q, want %w", got, want)
+		t.Errorf("get: got %q, want %q", got, want)
 	}
 }
 
@@ -202,8 +205,14 @@ func TestUnsetenvUnknown(t *testing.T) {
 // TestNotExisting tests the Set, Unset, Setenv and Unsetenv functions when the
 // GOENV file does not exists.
 func TestNotExisting(t *testing.T) {
+	// Recent versions of go env -w create the missing parent directories, so
+	// use a parent that is a regular file, to ensure the GOENV file can not be
+	// created.
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
 	config := env.Config{
-		Path: "/abc/xyz/noenv",
+		Path: filepath.Join(goenv.Name(), "noenv"),
 	}
 
 	// We only need to test the Setenv function.  Make sure to use a know
@@ -261,3 +270,459 @@ func TestSetGOENV(t *testing.T) {
 		t.Errorf("getenv: expected error")
 	}
 }
+
+// TestSetFile tests that the SetFile and UnsetFile functions write the GOENV
+// file in the same way as the Set and Unset functions.
+func TestSetFile(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+	native := envtest.NewFile(t)
+	defer native.Remove()
+
+	steps := []func(c *env.Config, native bool) error{
+		func(c *env.Config, native bool) error {
+			vars := map[string]string{"CC": "yy", "AR": "xx", "GOARCH": "arm64"}
+			if native {
+				return c.SetFile(vars)
+			}
+
+			return c.Set(vars)
+		},
+		func(c *env.Config, native bool) error {
+			vars := map[string]string{"GO386": "sse2", "AR": "zz"}
+			if native {
+				return c.SetFile(vars)
+			}
+
+			return c.Set(vars)
+		},
+		func(c *env.Config, native bool) error {
+			if native {
+				return c.UnsetFile("CC", "GOARCH")
+			}
+
+			return c.Unset("CC", "GOARCH")
+		},
+	}
+	for i, step := range steps {
+		if err := step(&goenv.Config, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := step(&native.Config, true); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := goenv.Read(), native.Read(); got != want {
+			t.Errorf("step %d: GOENV: got %q, want %q", i+1, got, want)
+		}
+	}
+
+	want := map[string]string{"AR": "zz", "GO386": "sse2"}
+	got, err := native.Config.ReadFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read file: got %q, want %q", got, want)
+	}
+}
+
+// TestSetFileInvalid tests the SetFile and UnsetFile functions with unknown
+// variables and invalid values, including the ones checked by the go
+// command.
+func TestSetFileInvalid(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
+	tests := []map[string]string{
+		{"XX": "yy"},
+		{"GOROOT": "/"},
+		{"GOENV": "/"},
+		{"GOPATH": "relative"},
+		{"GOPATH": "/a" + string(filepath.ListSeparator) + "relative"},
+		{"GOPATH": "/a" + string(filepath.ListSeparator) + "~/b"},
+		{"GO111MODULE": "xx"},
+		{"GOOS": "xxx"},
+	}
+	for _, vars := range tests {
+		if err := goenv.Config.SetFile(vars); err == nil {
+			t.Errorf("set file %q: expected error", vars)
+		}
+	}
+	if err := goenv.Config.UnsetFile("XX"); err == nil {
+		t.Errorf("unset file: expected error")
+	}
+	if data := goenv.Read(); data != "" {
+		t.Errorf("GOENV: expected empty, got %q", data)
+	}
+}
+
+// TestEncode tests that the Encode function sorts the entries as go env -w
+// does.
+func TestEncode(t *testing.T) {
+	vars := map[string]string{
+		"GO386": "sse2",
+		"GO":    "x",
+		"AR":    "ar",
+	}
+	const want = "AR=ar\nGO=x\nGO386=sse2\n"
+	if got := string(env.Encode(vars)); got != want {
+		t.Errorf("encode: got %q, want %q", got, want)
+	}
+	if got := env.Parse([]byte("# comment\n" + want + "AR=ar2\n")); !reflect.DeepEqual(got, map[string]string{"AR": "ar2", "GO": "x", "GO386": "sse2"}) {
+		t.Errorf("parse: got %q", got)
+	}
+}
+
+// TestLoad tests that the Load function returns the typed environment.
+func TestLoad(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
+	vars := map[string]string{
+		"GOPROXY":   "example.com|https://proxy.golang.org,direct",
+		"GOPRIVATE": "*.corp.example.com,rsc.io/private",
+	}
+	if err := goenv.Config.Set(vars); err != nil {
+		t.Fatal(err)
+	}
+	e, err := goenv.Config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.GOENV != goenv.Name() {
+		t.Errorf("load: got GOENV %q, want %q", e.GOENV, goenv.Name())
+	}
+	// The OS environment takes precedence over the GOENV file.
+	if os.Getenv("GOPROXY") == "" {
+		want := []env.Proxy{
+			{URL: "https://example.com", FallbackOnError: true},
+			{URL: "https://proxy.golang.org"},
+			{URL: "direct"},
+		}
+		if !reflect.DeepEqual(e.Proxies, want) {
+			t.Errorf("load: got proxies %+v, want %+v", e.Proxies, want)
+		}
+	}
+	if os.Getenv("GOPRIVATE") == "" {
+		want := []string{"*.corp.example.com", "rsc.io/private"}
+		if !reflect.DeepEqual(e.Private, want) {
+			t.Errorf("load: got private %q, want %q", e.Private, want)
+		}
+	}
+}
+
+// TestNewEnvironment tests the parsing of the list values.
+func TestNewEnvironment(t *testing.T) {
+	vars := map[string]string{
+		"GOFLAGS":      `-mod=mod "-ldflags=-s -w" '-tags=a b'`,
+		"GOPROXY":      "off,direct",
+		"GOEXPERIMENT": "x,noy,none,z,nofieldtrack",
+		"GOPATH":       "/a" + string(filepath.ListSeparator) + "/b",
+	}
+	e, err := env.NewEnvironment(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-mod=mod", "-ldflags=-s -w", "-tags=a b"}; !reflect.DeepEqual(e.Flags, want) {
+		t.Errorf("flags: got %q, want %q", e.Flags, want)
+	}
+	if len(e.Proxies) != 1 || !e.Proxies[0].IsOff() {
+		t.Errorf("proxies: got %+v", e.Proxies)
+	}
+	if want := (env.Experiments{"z": true, "fieldtrack": false}); !reflect.DeepEqual(e.Experiments, want) {
+		t.Errorf("experiments: got %v, want %v", e.Experiments, want)
+	}
+	if want := []string{"/a", "/b"}; !reflect.DeepEqual(e.Path, want) {
+		t.Errorf("path: got %q, want %q", e.Path, want)
+	}
+}
+
+// TestParseGOPROXY tests that the fallback of "direct" is kept, and that the
+// entries after "direct" and "off" are ignored.
+func TestParseGOPROXY(t *testing.T) {
+	tests := []struct {
+		goproxy string
+		want    []env.Proxy
+	}{
+		{"direct", []env.Proxy{{URL: "direct"}}},
+		{"direct|off", []env.Proxy{{URL: "direct", FallbackOnError: true}}},
+		{"direct,off", []env.Proxy{{URL: "direct"}}},
+		{"off|direct", []env.Proxy{{URL: "off"}}},
+		{"example.com|direct", []env.Proxy{
+			{URL: "https://example.com", FallbackOnError: true},
+			{URL: "direct"},
+		}},
+	}
+	for _, test := range tests {
+		got, err := env.ParseGOPROXY(test.goproxy)
+		if err != nil {
+			t.Errorf("parse %q: %v", test.goproxy, err)
+
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parse %q: got %+v, want %+v", test.goproxy, got, test.want)
+		}
+	}
+}
+
+// TestNewEnvironmentInvalid tests that malformed list values are reported.
+func TestNewEnvironmentInvalid(t *testing.T) {
+	tests := []map[string]string{
+		{"GOFLAGS": `"-mod=mod`},
+		{"GOFLAGS": "mod"},
+		{"GOFLAGS": "-=x"},
+		{"GOPROXY": " , |"},
+	}
+	for _, vars := range tests {
+		if _, err := env.NewEnvironment(vars); err == nil {
+			t.Errorf("new environment %q: expected error", vars)
+		}
+	}
+}
+
+// TestMatchPrefixPatterns tests the MatchPrefixPatterns function.
+func TestMatchPrefixPatterns(t *testing.T) {
+	tests := []struct {
+		globs, target string
+		want          bool
+	}{
+		{"*/quote", "rsc.io/quote", true},
+		{"*/quote", "rsc.io/quote/v3", true},
+		{"*/quote", "rsc.io/sampler", false},
+		{"rsc.io", "rsc.io/quote", true},
+		{"rsc.io/", "rsc.io/quote", true},
+		{"rsc.io/quote/v3", "rsc.io/quote", false},
+		{",,rsc.io,", "rsc.io/quote", true},
+		{"*.corp.example.com", "git.corp.example.com/x", true},
+		{"*.corp.example.com", "corp.example.com/x", false},
+		{"[", "rsc.io/quote", false},
+		{"", "rsc.io/quote", false},
+	}
+	for _, test := range tests {
+		if got := env.MatchPrefixPatterns(test.globs, test.target); got != test.want {
+			t.Errorf("match %q %q: got %v, want %v", test.globs, test.target, got, test.want)
+		}
+	}
+}
+
+// TestMatcher tests that GONOPROXY and GONOSUMDB default to GOPRIVATE, and
+// that the sources are the ones used by the go command.
+func TestMatcher(t *testing.T) {
+	e, err := env.NewEnvironment(map[string]string{
+		"GOPRIVATE":  "example.com/private",
+		"GONOSUMDB":  "example.com/nosumdb",
+		"GOINSECURE": "example.com/*",
+		"GOPROXY":    "https://proxy.golang.org|direct",
+		"GOSUMDB":    "sum.golang.org",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := env.NewMatcher(e)
+
+	// GONOSUMDB is set, so GOPRIVATE only applies to GONOPROXY.
+	f := m.Fetch("example.com/private/m")
+	if !f.Private || !f.Direct() || f.Proxied() || !f.SumDB || !f.Insecure {
+		t.Errorf("fetch private: got %+v", f)
+	}
+	f = m.Fetch("example.com/nosumdb/m")
+	if f.Private || f.Direct() || !f.Proxied() || f.SumDB {
+		t.Errorf("fetch nosumdb: got %+v", f)
+	}
+	if len(f.Sources) != 2 || !f.Sources[0].FallbackOnError {
+		t.Errorf("fetch nosumdb: got sources %+v", f.Sources)
+	}
+	f = m.Fetch("golang.org/x/text")
+	if f.Private || f.Direct() || !f.SumDB || f.Insecure {
+		t.Errorf("fetch public: got %+v", f)
+	}
+
+	m.GOSUMDB = "off"
+	if m.Fetch("golang.org/x/text").SumDB {
+		t.Error("fetch: expected no checksum database with GOSUMDB=off")
+	}
+}
+
+// TestApply tests that the Apply function applies all the changes, with the
+// last change of a variable taking effect.
+func TestApply(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
+	if err := goenv.Config.SetFile(map[string]string{"AR": "xx", "CC": "yy"}); err != nil {
+		t.Fatal(err)
+	}
+	err := goenv.Config.Apply(
+		env.Change{Key: "GOPRIVATE", Value: "example.com"},
+		env.Change{Key: "GOOS", Value: "linux"},
+		env.Change{Key: "CC", Unset: true},
+		env.Change{Key: "GOFLAGS", Value: "-mod=mod"},
+		env.Change{Key: "GOFLAGS", Value: "-mod=readonly"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"AR":        "xx",
+		"GOFLAGS":   "-mod=readonly",
+		"GOOS":      "linux",
+		"GOPRIVATE": "example.com",
+	}
+	if got := goenv.Read(); got != envtest.Encode(want) {
+		t.Errorf("GOENV: got %q, want %q", got, envtest.Encode(want))
+	}
+}
+
+// TestApplyInvalid tests that the Apply function does not modify the GOENV
+// file when a change is rejected, including by the go command.
+func TestApplyInvalid(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
+	vars := map[string]string{"GOPROXY": "direct"}
+	if err := goenv.Config.SetFile(vars); err != nil {
+		t.Fatal(err)
+	}
+	tests := [][]env.Change{
+		{{Key: "GOPRIVATE", Value: "example.com"}, {Key: "GOPATH", Value: "relative"}},
+		{{Key: "GOFLAGS", Value: "-mod=mod"}, {Key: "GOOS", Value: "xxx"}},
+		{{Key: "GOPROXY", Unset: true}, {Key: "XX", Unset: true}},
+	}
+	for _, changes := range tests {
+		if err := goenv.Config.Apply(changes...); err == nil {
+			t.Errorf("apply %+v: expected error", changes)
+		}
+		if got := goenv.Read(); got != envtest.Encode(vars) {
+			t.Errorf("apply %+v: GOENV: got %q, want %q", changes, got, envtest.Encode(vars))
+		}
+	}
+}
+
+// TestSnapshot tests that the Restore function restores the GOENV file
+// recorded by the Snapshot function.
+func TestSnapshot(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
+	if err := goenv.Config.SetFile(map[string]string{"AR": "xx"}); err != nil {
+		t.Fatal(err)
+	}
+	want := goenv.Read()
+	s, err := goenv.Config.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Env(); !reflect.DeepEqual(got, map[string]string{"AR": "xx"}) {
+		t.Errorf("snapshot: got %q", got)
+	}
+	err = goenv.Config.Apply(env.Change{Key: "AR", Unset: true}, env.Change{Key: "CC", Value: "yy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := goenv.Config.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	if got := goenv.Read(); got != want {
+		t.Errorf("restore: GOENV: got %q, want %q", got, want)
+	}
+
+	// A snapshot of a missing GOENV file removes it.
+	if err := goenv.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = goenv.Config.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := goenv.Config.SetFile(map[string]string{"AR": "xx"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := goenv.Config.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(goenv.Name()); !os.IsNotExist(err) {
+		t.Errorf("restore: expected GOENV to not exist, got %v", err)
+	}
+}
+
+// TestVars tests that the Vars function reports the source and the default
+// value of each variable.
+func TestVars(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
+	vars := map[string]string{"GOPRIVATE": "example.com", "GOFLAGS": "-tags=x"}
+	if err := goenv.Config.SetFile(vars); err != nil {
+		t.Fatal(err)
+	}
+	list, err := goenv.Config.Vars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]*env.Var)
+	for _, v := range list {
+		got[v.Name] = v
+	}
+
+	if v := got["GOPRIVATE"]; v == nil || v.Source != env.GOENVFile || v.Default != "" || !v.Changed() {
+		t.Errorf("vars: got GOPRIVATE %+v", v)
+	}
+	// GOFLAGS may be set in the process environment.
+	want := env.GOENVFile
+	if os.Getenv("GOFLAGS") != "" {
+		want = env.Environ
+	}
+	if v := got["GOFLAGS"]; v == nil || v.Source != want || v.Default != "" {
+		t.Errorf("vars: got GOFLAGS %+v, want source %v", v, want)
+	}
+	if v := got["GOENV"]; v == nil || v.Source != env.Environ || v.Value != goenv.Name() {
+		t.Errorf("vars: got GOENV %+v", v)
+	}
+	if v := got["GOOS"]; os.Getenv("GOOS") == "" && (v == nil || v.Source != env.Computed || v.Changed()) {
+		t.Errorf("vars: got GOOS %+v", v)
+	}
+
+	for _, v := range env.Changed(list) {
+		if !v.Changed() {
+			t.Errorf("changed: unexpected %+v", v)
+		}
+	}
+}
+
+// TestVarsToolchain tests that the Vars function, when a toolchain is
+// selected, reports the GOTOOLCHAIN value and source set by the user, instead
+// of the value forced by the toolchain.
+func TestVarsToolchain(t *testing.T) {
+	goenv := envtest.NewFile(t)
+	defer goenv.Remove()
+
+	tc, err := toolchain.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goenv.Config.Toolchain = tc
+	if err := goenv.Config.SetFile(map[string]string{"GOTOOLCHAIN": "path"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := goenv.Config.Vars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *env.Var
+	for _, v := range list {
+		if v.Name == "GOTOOLCHAIN" {
+			got = v
+		}
+	}
+
+	// GOTOOLCHAIN may be set in the process environment.
+	value, source := "path", env.GOENVFile
+	if v := os.Getenv("GOTOOLCHAIN"); v != "" {
+		value, source = v, env.Environ
+	}
+	if got == nil || got.Value != value || got.Source != source {
+		t.Errorf("vars: got GOTOOLCHAIN %+v, want %q from %v", got, value, source)
+	}
+}
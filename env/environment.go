@@ -0,0 +1,331 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The parsing of GOFLAGS, GOPROXY and GOEXPERIMENT has been adapted from
+// src/cmd/go/internal/base/goflags.go, src/cmd/internal/quoted/quoted.go,
+// src/cmd/go/internal/modfetch/proxy.go and src/internal/buildcfg/exp.go in
+// the Go source distribution.
+// Copyright 2018 The Go Authors. All rights reserved.
+
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Environment is the Go environment, as reported by go env -json.
+//
+// The variables with a list value are also available in parsed form.
+type Environment struct {
+	AR                    string
+	CC                    string
+	CGO_CFLAGS            string
+	CGO_CFLAGS_ALLOW      string
+	CGO_CFLAGS_DISALLOW   string
+	CGO_CPPFLAGS          string
+	CGO_CPPFLAGS_ALLOW    string
+	CGO_CPPFLAGS_DISALLOW string
+	CGO_CXXFLAGS          string
+	CGO_CXXFLAGS_ALLOW    string
+	CGO_CXXFLAGS_DISALLOW string
+	CGO_ENABLED           string
+	CGO_FFLAGS            string
+	CGO_FFLAGS_ALLOW      string
+	CGO_FFLAGS_DISALLOW   string
+	CGO_LDFLAGS           string
+	CGO_LDFLAGS_ALLOW     string
+	CGO_LDFLAGS_DISALLOW  string
+	CXX                   string
+	FC                    string
+	GCCGO                 string
+	GO111MODULE           string
+	GO386                 string
+	GOAMD64               string
+	GOARCH                string
+	GOARM                 string
+	GOARM64               string
+	GOAUTH                string
+	GOBIN                 string
+	GOCACHE               string
+	GOCACHEPROG           string
+	GODEBUG               string
+	GOENV                 string
+	GOEXE                 string
+	GOEXPERIMENT          string
+	GOFIPS140             string
+	GOFLAGS               string
+	GOGCCFLAGS            string
+	GOHOSTARCH            string
+	GOHOSTOS              string
+	GOINSECURE            string
+	GOMIPS                string
+	GOMIPS64              string
+	GOMOD                 string
+	GOMODCACHE            string
+	GONOPROXY             string
+	GONOSUMDB             string
+	GOOS                  string
+	GOPACKAGESDRIVER      string
+	GOPATH                string
+	GOPPC64               string
+	GOPRIVATE             string
+	GOPROXY               string
+	GORISCV64             string
+	GOROOT                string
+	GOSUMDB               string
+	GOTELEMETRY           string
+	GOTELEMETRYDIR        string
+	GOTMPDIR              string
+	GOTOOLCHAIN           string
+	GOTOOLDIR             string
+	GOVCS                 string
+	GOVERSION             string
+	GOWASM                string
+	GOWORK                string
+	GO_EXTLINK_ENABLED    string
+	PKG_CONFIG            string
+
+	// Parsed values.
+	Path        []string    `json:"-"` // GOPATH entries
+	Flags       []string    `json:"-"` // GOFLAGS, tokenized as the go command does
+	Proxies     []Proxy     `json:"-"` // GOPROXY entries
+	Experiments Experiments `json:"-"` // GOEXPERIMENT
+	Private     []string    `json:"-"` // GOPRIVATE patterns
+	NoProxy     []string    `json:"-"` // GONOPROXY patterns
+	NoSumDB     []string    `json:"-"` // GONOSUMDB patterns
+	Insecure    []string    `json:"-"` // GOINSECURE patterns
+}
+
+// Proxy is an entry in the GOPROXY list.
+type Proxy struct {
+	// URL is the proxy URL, or one of the special values "direct" and
+	// "off".  The https:// scheme is added when missing, as the go command
+	// does.
+	URL string
+
+	// FallbackOnError is true when the entry is followed by a "|" separator,
+	// so that the next entry is tried on any error.  With the "," separator
+	// the next entry is only tried when the module is not found.
+	FallbackOnError bool
+}
+
+// IsDirect reports whether the entry is the special "direct" value, to
+// download directly from version control repositories.
+func (p Proxy) IsDirect() bool {
+	return p.URL == "direct"
+}
+
+// IsOff reports whether the entry is the special "off" value, disallowing
+// downloads.
+func (p Proxy) IsOff() bool {
+	return p.URL == "off"
+}
+
+// Experiments is the set of experiments named in GOEXPERIMENT.  Each
+// experiment is true when enabled and false when disabled with the "no"
+// prefix.
+type Experiments map[string]bool
+
+// Enabled reports whether the experiment is explicitly enabled.
+func (e Experiments) Enabled(name string) bool {
+	return e[name]
+}
+
+// Load returns the typed Go environment.
+//
+// If the environment cannot be loaded or one of the list values is malformed,
+// Load returns a nil Environment and an error.
+func (c *Config) Load() (*Environment, error) {
+	return c.LoadContext(context.Background())
+}
+
+// LoadContext is like Load but includes a context.
+func (c *Config) LoadContext(ctx context.Context) (*Environment, error) {
+	stdout, err := c.invokeGo(ctx, []string{"-json"})
+	if err != nil {
+		return nil, fmt.Errorf("env: load: %w", err)
+	}
+	e, err := parseEnvironment(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("env: load: %w", err)
+	}
+
+	return e, nil
+}
+
+// Load returns the typed Go environment, using the default configuration.
+func Load() (*Environment, error) {
+	var c Config
+
+	return c.Load()
+}
+
+// NewEnvironment returns the typed Go environment corresponding to vars, as
+// returned by Get.
+func NewEnvironment(vars map[string]string) (*Environment, error) {
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return nil, fmt.Errorf("env: %w", err)
+	}
+	e, err := parseEnvironment(data)
+	if err != nil {
+		return nil, fmt.Errorf("env: %w", err)
+	}
+
+	return e, nil
+}
+
+func parseEnvironment(data []byte) (*Environment, error) {
+	e := new(Environment)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("JSON decode: %w", err)
+	}
+
+	var err error
+	if e.Flags, err = ParseGOFLAGS(e.GOFLAGS); err != nil {
+		return nil, err
+	}
+	if e.Proxies, err = ParseGOPROXY(e.GOPROXY); err != nil {
+		return nil, err
+	}
+	e.Experiments = ParseGOEXPERIMENT(e.GOEXPERIMENT)
+	e.Path = filepath.SplitList(e.GOPATH)
+	e.Private = splitPatterns(e.GOPRIVATE)
+	e.NoProxy = splitPatterns(e.GONOPROXY)
+	e.NoSumDB = splitPatterns(e.GONOSUMDB)
+	e.Insecure = splitPatterns(e.GOINSECURE)
+
+	return e, nil
+}
+
+// ParseGOFLAGS splits the GOFLAGS value in a list of flags, as the go command
+// does.  The flags are separated by spaces, and a flag can be quoted with
+// single or double quotes, without escapes.  Each flag must be in the form
+// -x, --x, -x=value or --x=value.
+func ParseGOFLAGS(s string) ([]string, error) {
+	var flags []string
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t\n\r")
+		if len(s) == 0 {
+			break
+		}
+		if s[0] == '"' || s[0] == '\'' {
+			quote := s[0]
+			i := strings.IndexByte(s[1:], quote)
+			if i < 0 {
+				return nil, fmt.Errorf("GOFLAGS: unterminated %c string", quote)
+			}
+			flags = append(flags, s[1:i+1])
+			s = s[i+2:]
+
+			continue
+		}
+		i := strings.IndexAny(s, " \t\n\r")
+		if i < 0 {
+			i = len(s)
+		}
+		flags = append(flags, s[:i])
+		s = s[i:]
+	}
+
+	for _, f := range flags {
+		if !strings.HasPrefix(f, "-") || f == "-" || f == "--" ||
+			strings.HasPrefix(f, "---") || strings.HasPrefix(f, "-=") ||
+			strings.HasPrefix(f, "--=") {
+			return nil, fmt.Errorf("GOFLAGS: non-flag %q", f)
+		}
+	}
+
+	return flags, nil
+}
+
+// ParseGOPROXY parses the GOPROXY value in a list of proxies, as the go
+// command does.  The entries after "direct" or "off" are ignored.
+func ParseGOPROXY(s string) ([]Proxy, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var list []Proxy
+	for goproxy := s; goproxy != ""; {
+		var url string
+		fallback := false
+		if i := strings.IndexAny(goproxy, ",|"); i >= 0 {
+			url = goproxy[:i]
+			fallback = goproxy[i] == '|'
+			goproxy = goproxy[i+1:]
+		} else {
+			url = goproxy
+			goproxy = ""
+		}
+
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		if url == "off" {
+			// "off" always fails hard.
+			list = append(list, Proxy{URL: url})
+
+			break
+		}
+		if url == "direct" {
+			list = append(list, Proxy{URL: url, FallbackOnError: fallback})
+
+			break
+		}
+		// Single-word tokens are reserved for built-in behaviors, and
+		// anything containing ":/" or matching an absolute file path must be
+		// a complete URL.  For all other paths, add https://.
+		if strings.ContainsAny(url, ".:/") && !strings.Contains(url, ":/") &&
+			!filepath.IsAbs(url) && !path.IsAbs(url) {
+			url = "https://" + url
+		}
+		list = append(list, Proxy{URL: url, FallbackOnError: fallback})
+	}
+	if list == nil {
+		return nil, errors.New("GOPROXY list is not the empty string, but contains no entries")
+	}
+
+	return list, nil
+}
+
+// ParseGOEXPERIMENT parses the comma separated GOEXPERIMENT value.  The
+// special value "none" discards the experiments specified before it.
+func ParseGOEXPERIMENT(s string) Experiments {
+	set := make(Experiments)
+	for _, name := range strings.Split(s, ",") {
+		switch {
+		case name == "":
+			continue
+		case name == "none":
+			set = make(Experiments)
+		case strings.HasPrefix(name, "no"):
+			set[name[2:]] = false
+		default:
+			set[name] = true
+		}
+	}
+
+	return set
+}
+
+// splitPatterns splits a comma separated list of patterns, as in GOPRIVATE,
+// ignoring empty patterns.
+func splitPatterns(s string) []string {
+	var buf []string
+	for _, p := range strings.Split(s, ",") {
+		if p != "" {
+			buf = append(buf, p)
+		}
+	}
+
+	return buf
+}
@@ -0,0 +1,432 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The file format, entryKey, sortEntries, checkWrite and the known variables
+// have been adapted from src/cmd/go/internal/envcmd/env.go,
+// src/cmd/go/internal/cfg/cfg.go and src/internal/cfg/cfg.go in the Go
+// source distribution.
+// Copyright 2012 The Go Authors. All rights reserved.
+
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// known is the set of the variables known to the go command, as in
+// internal/cfg.KnownEnv.
+var known = map[string]bool{
+	"AR":                    true,
+	"CC":                    true,
+	"CGO_CFLAGS":            true,
+	"CGO_CFLAGS_ALLOW":      true,
+	"CGO_CFLAGS_DISALLOW":   true,
+	"CGO_CPPFLAGS":          true,
+	"CGO_CPPFLAGS_ALLOW":    true,
+	"CGO_CPPFLAGS_DISALLOW": true,
+	"CGO_CXXFLAGS":          true,
+	"CGO_CXXFLAGS_ALLOW":    true,
+	"CGO_CXXFLAGS_DISALLOW": true,
+	"CGO_ENABLED":           true,
+	"CGO_FFLAGS":            true,
+	"CGO_FFLAGS_ALLOW":      true,
+	"CGO_FFLAGS_DISALLOW":   true,
+	"CGO_LDFLAGS":           true,
+	"CGO_LDFLAGS_ALLOW":     true,
+	"CGO_LDFLAGS_DISALLOW":  true,
+	"CXX":                   true,
+	"FC":                    true,
+	"GCCGO":                 true,
+	"GO111MODULE":           true,
+	"GO386":                 true,
+	"GOAMD64":               true,
+	"GOARCH":                true,
+	"GOARM":                 true,
+	"GOARM64":               true,
+	"GOAUTH":                true,
+	"GOBIN":                 true,
+	"GOCACHE":               true,
+	"GOCACHEPROG":           true,
+	"GOENV":                 true,
+	"GOEXE":                 true,
+	"GOEXPERIMENT":          true,
+	"GOFIPS140":             true,
+	"GOFLAGS":               true,
+	"GOGCCFLAGS":            true,
+	"GOHOSTARCH":            true,
+	"GOHOSTOS":              true,
+	"GOINSECURE":            true,
+	"GOMIPS":                true,
+	"GOMIPS64":              true,
+	"GOMODCACHE":            true,
+	"GONOPROXY":             true,
+	"GONOSUMDB":             true,
+	"GOOS":                  true,
+	"GOPATH":                true,
+	"GOPPC64":               true,
+	"GOPRIVATE":             true,
+	"GOPROXY":               true,
+	"GORISCV64":             true,
+	"GOROOT":                true,
+	"GOSUMDB":               true,
+	"GOTMPDIR":              true,
+	"GOTOOLCHAIN":           true,
+	"GOTOOLDIR":             true,
+	"GOVCS":                 true,
+	"GOWASM":                true,
+	"GOWORK":                true,
+	"GO_EXTLINK_ENABLED":    true,
+	"PKG_CONFIG":            true,
+}
+
+// toolchainChecked is the set of the variables with values that can only be
+// checked by the go command, since the check depends on the toolchain.
+var toolchainChecked = map[string]bool{
+	"CC":           true,
+	"CXX":          true,
+	"GOARCH":       true,
+	"GOEXPERIMENT": true,
+	"GOOS":         true,
+}
+
+// IsKnown reports whether key is a variable known to the go command.
+func IsKnown(key string) bool {
+	return known[key]
+}
+
+// File returns the path of the GOENV file: Path when set, otherwise $GOENV
+// or the default location in the user configuration directory.
+//
+// If GOENV is set to off, File returns an error.
+func (c *Config) File() (string, error) {
+	if c.Path != "" {
+		return c.Path, nil
+	}
+	if file := os.Getenv("GOENV"); file != "" {
+		if file == "off" {
+			return "", errors.New("env: GOENV=off")
+		}
+
+		return file, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("env: %w", err)
+	}
+
+	return filepath.Join(dir, "go", "env"), nil
+}
+
+// ReadFile reads the GOENV file directly, without running the go command, and
+// returns the variables set with Set or Setenv.  If the file does not exist,
+// ReadFile returns an empty map.
+//
+// Unlike Get, the returned values do not include the OS environment and the
+// defaults.
+func (c *Config) ReadFile() (map[string]string, error) {
+	file, err := c.File()
+	if err != nil {
+		return nil, err
+	}
+	lines, err := readLines(file)
+	if err != nil {
+		return nil, fmt.Errorf("env: read file: %w", err)
+	}
+
+	return Parse([]byte(strings.Join(lines, ""))), nil
+}
+
+// SetFile is like Set, but writes the GOENV file directly.  The go command is
+// only run, on a temporary copy of the GOENV file, to check the values of the
+// variables that depend on the toolchain, like GOOS and GOARCH.
+//
+// The lines of the GOENV file are kept in the same order used by go env -w.
+func (c *Config) SetFile(env map[string]string) error {
+	return c.SetFileContext(context.Background(), env)
+}
+
+// SetFileContext is like SetFile but includes a context.
+func (c *Config) SetFileContext(ctx context.Context, env map[string]string) error {
+	if len(env) == 0 {
+		return errors.New("env: write file: no variables")
+	}
+	check := false
+	for key, value := range env {
+		if err := c.checkWrite(key, value); err != nil {
+			return fmt.Errorf("env: write file: %w", err)
+		}
+		check = check || toolchainChecked[key]
+	}
+
+	return c.updateFile(ctx, check, env, nil)
+}
+
+// UnsetFile is like Unset, but writes the GOENV file directly.
+func (c *Config) UnsetFile(vars ...string) error {
+	return c.UnsetFileContext(context.Background(), vars...)
+}
+
+// UnsetFileContext is like UnsetFile but includes a context.
+func (c *Config) UnsetFileContext(ctx context.Context, vars ...string) error {
+	if len(vars) == 0 {
+		return errors.New("env: unset file: no variables")
+	}
+	check := false
+	del := make(map[string]bool)
+	for _, key := range vars {
+		if err := c.checkWrite(key, ""); err != nil {
+			return fmt.Errorf("env: unset file: %w", err)
+		}
+		check = check || toolchainChecked[key]
+		del[key] = true
+	}
+
+	return c.updateFile(ctx, check, nil, del)
+}
+
+// updateFile adds and deletes the variables in the GOENV file, like go env -w
+// and go env -u, and replaces the file atomically.  When check is true, the
+// changes are first applied to a temporary copy of the GOENV file by the go
+// command.
+func (c *Config) updateFile(ctx context.Context, check bool, add map[string]string, del map[string]bool) error {
+	file, err := c.File()
+	if err != nil {
+		return err
+	}
+	lines, err := readLines(file)
+	if err != nil {
+		return fmt.Errorf("env: write file: %w", err)
+	}
+	if check {
+		if err := c.checkToolchain(ctx, lines, add, del); err != nil {
+			return fmt.Errorf("env: write file: %w", err)
+		}
+	}
+
+	data := []byte(strings.Join(update(lines, add, del), ""))
+	if err := writeFile(file, data); err != nil {
+		return fmt.Errorf("env: write file: %w", err)
+	}
+
+	return nil
+}
+
+// checkToolchain runs go env -w or go env -u on a temporary copy of the GOENV
+// file, so that the go command can check the new values.
+func (c *Config) checkToolchain(ctx context.Context, lines []string, add map[string]string, del map[string]bool) error {
+	f, err := ioutil.TempFile("", "gocmd-*env")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strings.Join(lines, ""))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp := *c
+	tmp.Path = f.Name()
+	if len(add) > 0 {
+		argv := []string{"-w"}
+		argv = append(argv, flatenv(add)...)
+		if _, err := tmp.invokeGo(ctx, argv); err != nil {
+			return err
+		}
+	}
+	if len(del) > 0 {
+		argv := []string{"-u"}
+		for key := range del {
+			argv = append(argv, key)
+		}
+		if _, err := tmp.invokeGo(ctx, argv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkWrite checks that key can be written to the GOENV file with the
+// value, as go env -w does.  Keys already in the GOENV file are assumed to be
+// known.
+func (c *Config) checkWrite(key, val string) error {
+	switch key {
+	case "GOEXE", "GOGCCFLAGS", "GOHOSTARCH", "GOHOSTOS", "GOMOD", "GOROOT",
+		"GOTELEMETRY", "GOTELEMETRYDIR", "GOTOOLDIR", "GOVERSION", "GOWORK":
+		return fmt.Errorf("%s cannot be modified", key)
+	case "GOENV", "GODEBUG":
+		return fmt.Errorf("%s can only be set using the OS environment", key)
+	}
+	if !known[key] {
+		env, err := c.ReadFile()
+		if err != nil {
+			return err
+		}
+		if _, ok := env[key]; !ok {
+			return fmt.Errorf("unknown go command variable %s", key)
+		}
+	}
+
+	switch key {
+	case "GO111MODULE":
+		switch val {
+		case "", "auto", "on", "off":
+		default:
+			return fmt.Errorf("invalid %s value %q", key, val)
+		}
+	case "GOPATH":
+		// Check each entry, as the go command does when reading GOPATH, so
+		// that the GOENV file can not break the go command.
+		for _, entry := range filepath.SplitList(val) {
+			if strings.HasPrefix(entry, "~") {
+				return fmt.Errorf("GOPATH entry cannot start with shell metacharacter '~': %q", entry)
+			}
+			if !filepath.IsAbs(entry) && entry != "" {
+				return fmt.Errorf("GOPATH entry is relative; must be absolute path: %q", entry)
+			}
+		}
+	case "GOMODCACHE", "GOTMPDIR":
+		if !filepath.IsAbs(val) && val != "" {
+			return fmt.Errorf("%s entry is relative; must be absolute path: %q", key, val)
+		}
+	}
+	if !utf8.ValidString(val) {
+		return fmt.Errorf("invalid UTF-8 in %s=... value", key)
+	}
+	if strings.Contains(val, "\x00") {
+		return fmt.Errorf("invalid NUL in %s=... value", key)
+	}
+	if strings.ContainsAny(val, "\v\r\n") {
+		return fmt.Errorf("invalid newline in %s=... value", key)
+	}
+
+	return nil
+}
+
+// Parse parses the content of a GOENV file.  Comments, blank lines and
+// invalid lines are ignored, and the last value of a duplicated variable is
+// used, as the go command does.
+func Parse(data []byte) map[string]string {
+	env := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		i := strings.Index(line, "=")
+		if i < 0 || line[0] < 'A' || 'Z' < line[0] {
+			continue
+		}
+		env[line[:i]] = line[i+1:]
+	}
+
+	return env
+}
+
+// Encode encodes env in the format used by the GOENV file, with the entries
+// sorted as go env -w does.
+func Encode(env map[string]string) []byte {
+	buf := make([]string, 0, len(env))
+	for key, val := range env {
+		buf = append(buf, key+"="+val+"\n")
+	}
+	sortEntries(buf)
+
+	return []byte(strings.Join(buf, ""))
+}
+
+// readLines reads the GOENV file, returning its lines including the newline.
+// If the file does not exist, readLines returns no lines.
+func readLines(file string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += "\n"
+	}
+
+	return lines, nil
+}
+
+// update returns the lines of the GOENV file with the variables in add set
+// and the variables in del removed, using the same algorithm used by go env
+// -w and go env -u.
+func update(lines []string, add map[string]string, del map[string]bool) []string {
+	lines = append([]string(nil), lines...)
+
+	// Delete all but the last copy of any duplicated variable, since the
+	// last copy is the one that takes effect.
+	prev := make(map[string]int)
+	for i, line := range lines {
+		if key := entryKey(line); key != "" {
+			if p, ok := prev[key]; ok {
+				lines[p] = ""
+			}
+			prev[key] = i
+		}
+	}
+
+	// Update the existing lines, and add the new variables at the end.
+	var added []string
+	for key, val := range add {
+		if p, ok := prev[key]; ok {
+			lines[p] = key + "=" + val + "\n"
+		} else {
+			added = append(added, key+"="+val+"\n")
+		}
+	}
+	lines = append(lines, added...)
+	for key := range del {
+		if p, ok := prev[key]; ok {
+			lines[p] = ""
+		}
+	}
+
+	// Sort runs of KEY=VALUE lines, separated by comments, blank lines or
+	// invalid lines.
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i == len(lines) || entryKey(lines[i]) == "" {
+			sortEntries(lines[start:i])
+			start = i + 1
+		}
+	}
+
+	return lines
+}
+
+// entryKey returns the KEY part of the entry KEY=VALUE or else an empty
+// string.
+func entryKey(entry string) string {
+	i := strings.Index(entry, "=")
+	if i < 0 || strings.Contains(entry[:i], "#") {
+		return ""
+	}
+
+	return entry[:i]
+}
+
+// sortEntries sorts a sequence of entries by key.
+// It differs from sort.Strings in that GO386= sorts after GO=.
+//
+// sortEntries uses the same sorting algorithm used by go env.
+func sortEntries(entries []string) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entryKey(entries[i]) < entryKey(entries[j])
+	})
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// MatchPrefixPatterns has been adapted from golang.org/x/mod/module/module.go.
+// Copyright 2018 The Go Authors. All rights reserved.
+
+package env
+
+import (
+	"path"
+	"strings"
+)
+
+// Matcher reports how the go command treats a module path, according to the
+// GOPRIVATE, GONOPROXY, GONOSUMDB, GOINSECURE, GOPROXY and GOSUMDB variables.
+type Matcher struct {
+	// GOPRIVATE, GONOPROXY, GONOSUMDB and GOINSECURE are comma separated
+	// lists of glob patterns.  When GONOPROXY or GONOSUMDB is empty, GOPRIVATE
+	// is used, as the go command does.
+	GOPRIVATE  string
+	GONOPROXY  string
+	GONOSUMDB  string
+	GOINSECURE string
+
+	// Proxies is the parsed GOPROXY list.
+	Proxies []Proxy
+
+	// GOSUMDB is the checksum database.  When "off", the checksum database
+	// is never used.
+	GOSUMDB string
+}
+
+// NewMatcher returns the matcher for the Go environment.
+func NewMatcher(e *Environment) *Matcher {
+	m := &Matcher{
+		GOPRIVATE:  e.GOPRIVATE,
+		GONOPROXY:  e.GONOPROXY,
+		GONOSUMDB:  e.GONOSUMDB,
+		GOINSECURE: e.GOINSECURE,
+		Proxies:    e.Proxies,
+		GOSUMDB:    e.GOSUMDB,
+	}
+
+	return m
+}
+
+// Private reports whether the module path is private, as specified by
+// GOPRIVATE.
+func (m *Matcher) Private(modpath string) bool {
+	return MatchPrefixPatterns(m.GOPRIVATE, modpath)
+}
+
+// NoProxy reports whether the module path is excluded from the proxies, as
+// specified by GONOPROXY or else GOPRIVATE.
+func (m *Matcher) NoProxy(modpath string) bool {
+	return MatchPrefixPatterns(or(m.GONOPROXY, m.GOPRIVATE), modpath)
+}
+
+// NoSumDB reports whether the module path is not verified using the checksum
+// database, as specified by GOSUMDB, GONOSUMDB or else GOPRIVATE.
+func (m *Matcher) NoSumDB(modpath string) bool {
+	return m.GOSUMDB == "off" || MatchPrefixPatterns(or(m.GONOSUMDB, m.GOPRIVATE), modpath)
+}
+
+// Insecure reports whether the module path can be fetched using insecure
+// schemes, as specified by GOINSECURE.
+func (m *Matcher) Insecure(modpath string) bool {
+	return MatchPrefixPatterns(m.GOINSECURE, modpath)
+}
+
+// Direct reports whether the module path is fetched directly from its version
+// control repository, without trying a proxy first.
+func (m *Matcher) Direct(modpath string) bool {
+	sources := m.Sources(modpath)
+
+	return len(sources) > 0 && sources[0].IsDirect()
+}
+
+// Sources returns the sources tried, in order, when fetching the module
+// path: the proxies in GOPROXY, or only "direct" when the module path is
+// excluded from the proxies.
+func (m *Matcher) Sources(modpath string) []Proxy {
+	if m.NoProxy(modpath) {
+		return []Proxy{{URL: "direct"}}
+	}
+
+	return m.Proxies
+}
+
+// Fetch describes how the module path will be fetched.
+func (m *Matcher) Fetch(modpath string) *Fetch {
+	f := &Fetch{
+		Sources:  m.Sources(modpath),
+		SumDB:    !m.NoSumDB(modpath),
+		Private:  m.Private(modpath),
+		Insecure: m.Insecure(modpath),
+	}
+
+	return f
+}
+
+// Fetch describes how the go command fetches a module.
+type Fetch struct {
+	Sources  []Proxy // sources tried, in order
+	SumDB    bool    // verified using the checksum database
+	Private  bool    // matched by GOPRIVATE
+	Insecure bool    // insecure schemes allowed
+}
+
+// Direct reports whether the module is fetched directly from its version
+// control repository, without trying a proxy first.
+func (f *Fetch) Direct() bool {
+	return len(f.Sources) > 0 && f.Sources[0].IsDirect()
+}
+
+// Proxied reports whether the module path may be sent to a proxy.
+func (f *Fetch) Proxied() bool {
+	for _, p := range f.Sources {
+		if !p.IsDirect() && !p.IsOff() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchPrefixPatterns reports whether any path prefix of target matches one
+// of the glob patterns, in the comma separated globs list, as with
+// path.Match.  It ignores any empty or malformed patterns in the list.  A
+// trailing slash on a pattern is ignored.
+func MatchPrefixPatterns(globs, target string) bool {
+	for globs != "" {
+		// Extract the next non-empty glob in the comma separated list.
+		var glob string
+		if i := strings.Index(globs, ","); i >= 0 {
+			glob, globs = globs[:i], globs[i+1:]
+		} else {
+			glob, globs = globs, ""
+		}
+		glob = strings.TrimSuffix(glob, "/")
+		if glob == "" {
+			continue
+		}
+
+		// A glob with N+1 path elements (N slashes) needs to be matched
+		// against the first N+1 path elements of target, which end just
+		// before the N+1'th slash.
+		n := strings.Count(glob, "/")
+		prefix := target
+		for i := 0; i < len(target); i++ {
+			if target[i] == '/' {
+				if n == 0 {
+					prefix = target[:i]
+
+					break
+				}
+				n--
+			}
+		}
+		if n > 0 {
+			// Not enough prefix elements.
+			continue
+		}
+		if matched, _ := path.Match(glob, prefix); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// or returns a if not empty, and b otherwise.
+func or(a, b string) string {
+	if a != "" {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot is the content of the GOENV file at a point in time.
+type Snapshot struct {
+	Path   string // path of the GOENV file
+	Data   []byte // content of the GOENV file
+	Exists bool   // false if the GOENV file did not exist
+}
+
+// Env returns the variables set in the snapshot.
+func (s *Snapshot) Env() map[string]string {
+	return Parse(s.Data)
+}
+
+// Change is a change to a variable in the GOENV file.
+type Change struct {
+	Key   string // variable name
+	Value string // new value, when Unset is false
+	Unset bool   // remove the variable, like go env -u
+}
+
+// Snapshot returns a snapshot of the GOENV file, that can be later used to
+// restore it with Restore.
+func (c *Config) Snapshot() (*Snapshot, error) {
+	file, err := c.File()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("env: snapshot: %w", err)
+	}
+	s := &Snapshot{
+		Path:   file,
+		Data:   data,
+		Exists: err == nil,
+	}
+
+	return s, nil
+}
+
+// Restore restores the GOENV file recorded in the snapshot s.  If the GOENV
+// file did not exist when the snapshot was taken, it is removed.
+//
+// The file is replaced atomically.
+func (c *Config) Restore(s *Snapshot) error {
+	if !s.Exists {
+		if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("env: restore: %w", err)
+		}
+
+		return nil
+	}
+	if err := writeFile(s.Path, s.Data); err != nil {
+		return fmt.Errorf("env: restore: %w", err)
+	}
+
+	return nil
+}
+
+// Apply applies all the changes to the GOENV file as a single transaction:
+// either all the changes are applied, or the GOENV file is not modified.
+// When the same variable is changed more than once, the last change is
+// used.
+//
+// All the values are checked before the GOENV file is modified, as with
+// SetFile, and the file is replaced atomically.
+func (c *Config) Apply(changes ...Change) error {
+	return c.ApplyContext(context.Background(), changes...)
+}
+
+// ApplyContext is like Apply but includes a context.
+func (c *Config) ApplyContext(ctx context.Context, changes ...Change) error {
+	if len(changes) == 0 {
+		return errors.New("env: apply: no changes")
+	}
+	check := false
+	add := make(map[string]string)
+	del := make(map[string]bool)
+	for _, ch := range changes {
+		if err := c.checkWrite(ch.Key, ch.Value); err != nil {
+			return fmt.Errorf("env: apply: %w", err)
+		}
+		check = check || toolchainChecked[ch.Key]
+		if ch.Unset {
+			delete(add, ch.Key)
+			del[ch.Key] = true
+		} else {
+			delete(del, ch.Key)
+			add[ch.Key] = ch.Value
+		}
+	}
+
+	return c.updateFile(ctx, check, add, del)
+}
+
+// writeFile writes data to file atomically, by writing a temporary file in
+// the same directory and renaming it.  The directory is created if
+// necessary, as go env -w does, and the mode of an existing file is kept.
+func writeFile(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	var mode os.FileMode = 0644
+	if fi, err := os.Stat(file); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(file)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails silently after the rename
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), file)
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/invoke"
+)
+
+// Source is the source of the value of a Go environment variable.
+type Source int
+
+// Values for Source, in increasing order of precedence.
+const (
+	Computed   Source = iota // computed by the go command
+	GOROOTFile               // set in $GOROOT/go.env
+	GOENVFile                // set in the GOENV file, with go env -w
+	Environ                  // set in the process environment
+)
+
+var sourceNames = []string{
+	Computed:   "default",
+	GOROOTFile: "$GOROOT/go.env",
+	GOENVFile:  "GOENV",
+	Environ:    "environment",
+}
+
+// String implements the Stringer interface.
+func (s Source) String() string {
+	if s < 0 || int(s) >= len(sourceNames) {
+		return "Source(" + strconv.Itoa(int(s)) + ")"
+	}
+
+	return sourceNames[s]
+}
+
+// Var describes a Go environment variable.
+type Var struct {
+	Name    string // variable name
+	Value   string // effective value, as reported by go env
+	Default string // value in an empty environment, without a GOENV file
+	Source  Source // where the effective value comes from
+}
+
+// derived is the set of the variables that only report information about
+// the go command and the current module, and cannot be changed.
+var derived = map[string]bool{
+	"GOEXE":      true,
+	"GOGCCFLAGS": true,
+	"GOHOSTARCH": true,
+	"GOHOSTOS":   true,
+	"GOMOD":      true,
+	"GOTOOLDIR":  true,
+	"GOVERSION":  true,
+}
+
+// Changed reports whether the effective value differs from the default
+// value, as with go env -changed.  The variables that cannot be changed, like
+// GOMOD and GOGCCFLAGS, are never reported as changed.
+func (v *Var) Changed() bool {
+	return !derived[v.Name] && v.Value != v.Default
+}
+
+// Vars returns all the Go environment variables, sorted by name, with their
+// effective value, their default value and the source of the effective
+// value.
+//
+// The default values are obtained by running go env with the Go environment
+// variables removed from the process environment and GOENV set to off, so
+// that the values set in $GOROOT/go.env are still used.  The computed
+// defaults depending on other variables, like GOMODCACHE, are reported as
+// changed when those variables are changed.
+//
+// When Toolchain is set, the go command is run with GOTOOLCHAIN set to
+// local; GOTOOLCHAIN is instead reported with the value and the source that
+// the go command would use without the Toolchain option.
+func (c *Config) Vars() ([]*Var, error) {
+	return c.VarsContext(context.Background())
+}
+
+// VarsContext is like Vars but includes a context.
+func (c *Config) VarsContext(ctx context.Context) ([]*Var, error) {
+	value, err := c.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	def, err := c.defaults(ctx, value)
+	if err != nil {
+		return nil, fmt.Errorf("env: vars: %w", err)
+	}
+	file, err := c.fileVars()
+	if err != nil {
+		return nil, fmt.Errorf("env: vars: %w", err)
+	}
+	goroot, err := readGOROOTFile(value["GOROOT"])
+	if err != nil {
+		return nil, fmt.Errorf("env: vars: %w", err)
+	}
+	if c.Toolchain != nil {
+		// The go command is run with GOTOOLCHAIN set to local, so the
+		// reported value is not the one set by the user.
+		value["GOTOOLCHAIN"] = first(os.Getenv("GOTOOLCHAIN"), file["GOTOOLCHAIN"],
+			goroot["GOTOOLCHAIN"], def["GOTOOLCHAIN"])
+	}
+
+	vars := make([]*Var, 0, len(value))
+	for name, val := range value {
+		v := &Var{
+			Name:    name,
+			Value:   val,
+			Default: def[name],
+		}
+		switch {
+		case os.Getenv(name) != "" || c.overrides(name):
+			v.Source = Environ
+		case file[name] != "" && name != "GOENV":
+			v.Source = GOENVFile
+		case goroot[name] != "":
+			v.Source = GOROOTFile
+		}
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+
+	return vars, nil
+}
+
+// Vars returns all the Go environment variables, using the default
+// configuration.
+func Vars() ([]*Var, error) {
+	var c Config
+
+	return c.Vars()
+}
+
+// Changed returns the variables whose effective value differs from the
+// default value.
+func Changed(vars []*Var) []*Var {
+	var buf []*Var
+	for _, v := range vars {
+		if v.Changed() {
+			buf = append(buf, v)
+		}
+	}
+
+	return buf
+}
+
+// defaults returns the default value of the Go environment variables, by
+// running go env in an environment without the variables in vars and the
+// known variables.
+func (c *Config) defaults(ctx context.Context, vars map[string]string) (map[string]string, error) {
+	var environ []string
+	for _, ent := range os.Environ() {
+		key := ent
+		if i := strings.Index(ent, "="); i >= 0 {
+			key = ent[:i]
+		}
+		if _, ok := vars[key]; ok || known[key] {
+			continue
+		}
+		environ = append(environ, ent)
+	}
+	// GOTOOLCHAIN is set to local, so that the go command does not switch to
+	// a different toolchain.  The default value is set in $GOROOT/go.env.
+	environ = append(environ, "GOENV=off", "GOTOOLCHAIN=local")
+
+	attr := invoke.Attr{
+		Env:       environ,
+		Runner:    c.Runner,
+		Toolchain: c.Toolchain,
+	}
+	stdout, err := invoke.GoContext(ctx, "env", []string{"-json"}, &attr)
+	if err != nil {
+		return nil, err
+	}
+	def, err := decode(stdout)
+	if err != nil {
+		return nil, err
+	}
+	goroot, err := readGOROOTFile(def["GOROOT"])
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := goroot["GOTOOLCHAIN"]; ok {
+		def["GOTOOLCHAIN"] = v
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		def["GOENV"] = filepath.Join(dir, "go", "env")
+	}
+
+	return def, nil
+}
+
+// overrides reports whether the variable is set in the process environment of
+// the go command by the configuration.
+func (c *Config) overrides(name string) bool {
+	return name == "GOENV" && c.Path != ""
+}
+
+// first returns the first non empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// fileVars returns the variables set in the GOENV file, or nil if GOENV is
+// set to off.
+func (c *Config) fileVars() (map[string]string, error) {
+	if c.Path == "" && os.Getenv("GOENV") == "off" {
+		return nil, nil
+	}
+
+	return c.ReadFile()
+}
+
+// readGOROOTFile reads the $GOROOT/go.env file.  If the file does not exist,
+// readGOROOTFile returns an empty map.
+func readGOROOTFile(goroot string) (map[string]string, error) {
+	if goroot == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(goroot, "go.env"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return Parse(data), nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The sorting of go.sum lines has been adapted from
+// src/cmd/go/internal/modfetch/fetch.go in the Go source distribution.
+// Copyright 2018 The Go Authors. All rights reserved.
+
+// Package gosum implements support for parsing, writing and verifying go.sum
+// files.
+package gosum
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/semver"
+)
+
+// goModSuffix is the version suffix of the lines with the hash of the go.mod
+// file.
+const goModSuffix = "/go.mod"
+
+// Line is a line in a go.sum file.
+type Line struct {
+	Path    string // module path
+	Version string // module version, without the /go.mod suffix
+	GoMod   bool   // hash of the go.mod file, instead of the module zip
+	Hash    string // hash, as in h1:base64
+}
+
+// String returns the line in the go.sum format, without the newline.
+func (l Line) String() string {
+	version := l.Version
+	if l.GoMod {
+		version += goModSuffix
+	}
+
+	return l.Path + " " + version + " " + l.Hash
+}
+
+// key returns the line without the hash.
+func (l Line) key() Line {
+	l.Hash = ""
+
+	return l
+}
+
+// File is a go.sum file.
+type File struct {
+	Lines []Line
+}
+
+// Parse parses the content of a go.sum file.  Blank lines are ignored.
+func Parse(data []byte) (*File, error) {
+	f := new(File)
+	for n, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("gosum: line %d: wrong number of fields %d", n+1, len(fields))
+		}
+		l := Line{
+			Path:    fields[0],
+			Version: fields[1],
+			Hash:    fields[2],
+		}
+		if strings.HasSuffix(l.Version, goModSuffix) {
+			l.Version = strings.TrimSuffix(l.Version, goModSuffix)
+			l.GoMod = true
+		}
+		f.Lines = append(f.Lines, l)
+	}
+
+	return f, nil
+}
+
+// ReadFile reads and parses the named go.sum file.
+func ReadFile(name string) (*File, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("gosum: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Format returns the content of the go.sum file, with the lines sorted as
+// the go command does and the duplicate lines removed.
+func (f *File) Format() []byte {
+	lines := make([]Line, len(f.Lines))
+	copy(lines, f.Lines)
+	sort.Slice(lines, func(i, j int) bool {
+		return less(lines[i], lines[j])
+	})
+
+	var buf bytes.Buffer
+	for i, l := range lines {
+		if i > 0 && l == lines[i-1] {
+			continue
+		}
+		buf.WriteString(l.String())
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// WriteFile writes the go.sum file to the named file, as returned by Format.
+func (f *File) WriteFile(name string) error {
+	if err := ioutil.WriteFile(name, f.Format(), 0666); err != nil {
+		return fmt.Errorf("gosum: %w", err)
+	}
+
+	return nil
+}
+
+// Lookup returns the hashes of the module zip, or of the go.mod file when
+// gomod is true, for the module path and version.
+func (f *File) Lookup(path, version string, gomod bool) []string {
+	var buf []string
+	for _, l := range f.Lines {
+		if l.Path == path && l.Version == version && l.GoMod == gomod {
+			buf = append(buf, l.Hash)
+		}
+	}
+
+	return buf
+}
+
+// less reports whether a sorts before b: by module path, then by semantic
+// version with the zip hash before the go.mod hash, then by hash.
+func less(a, b Line) bool {
+	if a.Path != b.Path {
+		return a.Path < b.Path
+	}
+	if a.Version != b.Version {
+		return semver.Compare(a.Version, b.Version) < 0
+	}
+	if a.GoMod != b.GoMod {
+		return !a.GoMod
+	}
+
+	return a.Hash < b.Hash
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosum
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/perillo/gocmd/modfetch"
+	"github.com/perillo/gocmd/runner"
+)
+
+// TestFormat tests that the Parse function and the Format method work
+// correctly.
+func TestFormat(t *testing.T) {
+	const data = `
+golang.org/x/text v0.3.0/go.mod h1:NqM8EUOU14njkJ3fqMW+pc6Ldnwhi/IjpwHt7yyuwOQ=
+gopkg.in/yaml.v2 v2.2.1 h1:mUhvW9EsL+naU5Q3cakzfE91YhliOondGd6ZrsDBHQE=
+golang.org/x/text v0.10.0 h1:UpjohKhiEgNc0CSauXmwYftY1+LlaC75SJwh0SgCX58=
+golang.org/x/text v0.3.0 h1:g61tztE5qeGQ89tm6NTjjM9VPIm088od1l6aSorWRWg=
+golang.org/x/text v0.3.0 h1:g61tztE5qeGQ89tm6NTjjM9VPIm088od1l6aSorWRWg=
+`
+	const want = `golang.org/x/text v0.3.0 h1:g61tztE5qeGQ89tm6NTjjM9VPIm088od1l6aSorWRWg=
+golang.org/x/text v0.3.0/go.mod h1:NqM8EUOU14njkJ3fqMW+pc6Ldnwhi/IjpwHt7yyuwOQ=
+golang.org/x/text v0.10.0 h1:UpjohKhiEgNc0CSauXmwYftY1+LlaC75SJwh0SgCX58=
+gopkg.in/yaml.v2 v2.2.1 h1:mUhvW9EsL+naU5Q3cakzfE91YhliOondGd6ZrsDBHQE=
+`
+	f, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Lines) != 5 {
+		t.Fatalf("parse: expected 5, got %d lines", len(f.Lines))
+	}
+	l := Line{
+		Path:    "golang.org/x/text",
+		Version: "v0.3.0",
+		GoMod:   true,
+		Hash:    "h1:NqM8EUOU14njkJ3fqMW+pc6Ldnwhi/IjpwHt7yyuwOQ=",
+	}
+	if f.Lines[0] != l {
+		t.Errorf("parse: got %+v, want %+v", f.Lines[0], l)
+	}
+	if got := string(f.Format()); got != want {
+		t.Errorf("format: got %q, want %q", got, want)
+	}
+}
+
+// TestParseFail tests that the Parse function reports malformed lines.
+func TestParseFail(t *testing.T) {
+	const data = "golang.org/x/text v0.3.0\n"
+
+	if _, err := Parse([]byte(data)); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// TestEscape tests the escape function.
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"github.com/BurntSushi/toml", "github.com/!burnt!sushi/toml"},
+		{"v1.0.0-RC1", "v1.0.0-!r!c1"},
+	}
+	for _, test := range tests {
+		got, err := escape(test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("escape %q: got %q, want %q", test.s, got, test.want)
+		}
+	}
+	if _, err := escape("github.com/!x"); err == nil {
+		t.Error("escape: expected an error")
+	}
+}
+
+// TestVerify tests the Verify method, using the hashes reported by go mod
+// download.
+func TestVerify(t *testing.T) {
+	l := modfetch.Loader{
+		Dir: os.TempDir(),
+	}
+	mods, err := l.Load("golang.org/x/text@v0.3.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := mods[0]
+
+	// The recomputed hashes must match the ones reported by the go command.
+	if hash, err := HashZip(mod.Zip); err != nil || hash != mod.Sum {
+		t.Errorf("hash zip: got %q, %v, want %q", hash, err, mod.Sum)
+	}
+	if hash, err := HashGoMod(mod.GoMod); err != nil || hash != mod.GoModSum {
+		t.Errorf("hash go.mod: got %q, %v, want %q", hash, err, mod.GoModSum)
+	}
+
+	const bad = "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	zip := Line{Path: mod.Path, Version: mod.Version, Hash: mod.Sum}
+	gomod := Line{Path: mod.Path, Version: mod.Version, GoMod: true, Hash: bad}
+	extra := Line{Path: "example.com/xxx", Version: "v1.0.0", Hash: bad}
+	missing := Line{Path: "example.com/yyy", Version: "v1.0.0", GoMod: true}
+	f := &File{
+		Lines: []Line{zip, gomod, extra},
+	}
+
+	v := Verifier{}
+	r, err := v.Verify(f, append(Expected(mods), missing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Report{
+		Missing:    []Line{missing},
+		Extra:      []Line{extra},
+		Mismatched: []Mismatch{{Line: gomod, Hash: mod.GoModSum}},
+		Uncached:   []Line{extra},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("verify: got %+v, want %+v", r, want)
+	}
+	if r.OK() {
+		t.Error("verify: expected problems")
+	}
+}
+
+// TestVerifyRunner tests that the Verify method uses the custom runner to
+// get GOMODCACHE.
+func TestVerifyRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var argv []string
+	v := Verifier{
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			argv = inv.Argv
+			res := &runner.Result{
+				Stdout: []byte(dir + "\n"),
+			}
+
+			return res, nil
+		}),
+	}
+	line := Line{Path: "golang.org/x/text", Version: "v0.3.0", Hash: "h1:g61tztE5qeGQ89tm6NTjjM9VPIm088od1l6aSorWRWg="}
+	r, err := v.Verify(&File{Lines: []Line{line}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"env", "GOMODCACHE"}; !reflect.DeepEqual(argv, want) {
+		t.Errorf("runner: got argv %q, want %q", argv, want)
+	}
+	if want := []Line{line}; !reflect.DeepEqual(r.Uncached, want) {
+		t.Errorf("verify: got uncached %v, want %v", r.Uncached, want)
+	}
+}
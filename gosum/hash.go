@@ -0,0 +1,99 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The hash1 and escape functions have been adapted from
+// golang.org/x/mod/sumdb/dirhash/hash.go and golang.org/x/mod/module/module.go.
+// Copyright 2018 The Go Authors. All rights reserved.
+
+package gosum
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// HashZip returns the h1 hash of the module zip file, as in go.sum.
+func HashZip(name string) (string, error) {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return "", err
+	}
+	defer z.Close()
+
+	files := make([]string, 0, len(z.File))
+	zfiles := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files = append(files, f.Name)
+		zfiles[f.Name] = f
+	}
+	open := func(name string) (io.ReadCloser, error) {
+		return zfiles[name].Open()
+	}
+
+	return hash1(files, open)
+}
+
+// HashGoMod returns the h1 hash of the go.mod file, as in go.sum.
+func HashGoMod(name string) (string, error) {
+	open := func(string) (io.ReadCloser, error) {
+		return os.Open(name)
+	}
+
+	return hash1([]string{"go.mod"}, open)
+}
+
+// hash1 implements the h1 hash: the SHA-256 hash of a summary listing the
+// SHA-256 hash of each file, sorted by name.
+func hash1(files []string, open func(string) (io.ReadCloser, error)) (string, error) {
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, file := range files {
+		if strings.Contains(file, "\n") {
+			return "", errors.New("filenames with newlines are not supported")
+		}
+		r, err := open(file)
+		if err != nil {
+			return "", err
+		}
+		hf := sha256.New()
+		_, err = io.Copy(hf, r)
+		r.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%x  %s\n", hf.Sum(nil), file)
+	}
+
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// escape returns the safe encoding of the module path or version, used in
+// the module cache: each upper case letter is replaced by an exclamation
+// mark followed by the letter's lower case.
+func escape(s string) (string, error) {
+	var buf strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '!' || r >= utf8.RuneSelf:
+			return "", fmt.Errorf("invalid character %q in %q", r, s)
+		case 'A' <= r && r <= 'Z':
+			buf.WriteByte('!')
+			buf.WriteRune(r + 'a' - 'A')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosum
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/gocmd/env"
+	"github.com/perillo/gocmd/modfetch"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
+)
+
+// Mismatch is a go.sum line with a hash that does not match the hash of the
+// cached file.
+type Mismatch struct {
+	Line Line
+	Hash string // hash of the cached file
+}
+
+// Report is the result of the verification of a go.sum file.
+type Report struct {
+	// Missing are the expected lines that are not in the go.sum file.
+	Missing []Line
+
+	// Extra are the lines in the go.sum file that are not expected.
+	Extra []Line
+
+	// Mismatched are the lines with a hash that does not match the hash of
+	// the cached file.
+	Mismatched []Mismatch
+
+	// Uncached are the lines that cannot be verified, since the file is not
+	// in the module cache.
+	Uncached []Line
+}
+
+// OK reports whether the go.sum file has no missing, extra or mismatched
+// lines.
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// Verifier verifies go.sum files against the module cache, without network
+// access.
+type Verifier struct {
+	// GOMODCACHE is the module cache directory.  If empty, the value reported
+	// by go env GOMODCACHE is used.
+	GOMODCACHE string
+
+	// Runner is the runner used to run the go env command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go env command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+}
+
+// Verify verifies the lines in the go.sum file, by recomputing the hash of the
+// cached module zip and go.mod files.  Only h1 hashes are verified.
+//
+// When expected is not nil, Verify also reports the expected lines missing
+// from the go.sum file and the lines in the go.sum file that are not
+// expected.  The hash of the expected lines is ignored.
+func (v *Verifier) Verify(f *File, expected []Line) (*Report, error) {
+	cache := v.GOMODCACHE
+	if cache == "" {
+		c := env.Config{
+			Runner:    v.Runner,
+			Toolchain: v.Toolchain,
+		}
+		value, err := c.Getenv("GOMODCACHE")
+		if err != nil {
+			return nil, fmt.Errorf("gosum: verify: %w", err)
+		}
+		cache = value
+	}
+
+	r := new(Report)
+	for _, l := range f.Lines {
+		if !strings.HasPrefix(l.Hash, "h1:") {
+			continue
+		}
+		hash, err := v.hash(cache, l)
+		if os.IsNotExist(err) {
+			r.Uncached = append(r.Uncached, l)
+
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gosum: verify %s: %w", l, err)
+		}
+		if hash != l.Hash {
+			r.Mismatched = append(r.Mismatched, Mismatch{Line: l, Hash: hash})
+		}
+	}
+	if expected == nil {
+		return r, nil
+	}
+
+	have := make(map[Line]bool)
+	for _, l := range f.Lines {
+		have[l.key()] = true
+	}
+	want := make(map[Line]bool)
+	for _, l := range expected {
+		want[l.key()] = true
+		if !have[l.key()] {
+			r.Missing = append(r.Missing, l)
+		}
+	}
+	for _, l := range f.Lines {
+		if !want[l.key()] {
+			r.Extra = append(r.Extra, l)
+		}
+	}
+
+	return r, nil
+}
+
+// hash returns the hash of the cached file for the line.
+func (v *Verifier) hash(cache string, l Line) (string, error) {
+	path, err := escape(l.Path)
+	if err != nil {
+		return "", err
+	}
+	version, err := escape(l.Version)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(cache, "cache", "download", filepath.FromSlash(path), "@v", version)
+	if l.GoMod {
+		return HashGoMod(name + ".mod")
+	}
+
+	return HashZip(name + ".zip")
+}
+
+// Expected returns the go.sum lines expected for the modules, as returned by
+// modfetch.  Each module has a line for the zip file and a line for the
+// go.mod file, when the corresponding hash is available.
+func Expected(mods []*modfetch.Module) []Line {
+	lines := make([]Line, 0, 2*len(mods))
+	for _, mod := range mods {
+		if mod.Sum != "" {
+			l := Line{Path: mod.Path, Version: mod.Version, Hash: mod.Sum}
+			lines = append(lines, l)
+		}
+		if mod.GoModSum != "" {
+			l := Line{Path: mod.Path, Version: mod.Version, GoMod: true, Hash: mod.GoModSum}
+			lines = append(lines, l)
+		}
+	}
+
+	return lines
+}
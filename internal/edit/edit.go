@@ -0,0 +1,24 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package edit implements the editing operations shared by the go mod edit
+// and go work edit commands.
+package edit
+
+// Edit is an editing operation, corresponding to one of the go mod edit or go
+// work edit editing flags.
+type Edit struct {
+	flag  string
+	value string
+}
+
+// New returns the edit for the flag with the value.
+func New(flag, value string) Edit {
+	return Edit{flag, value}
+}
+
+// String returns the edit as a command line flag.
+func (e Edit) String() string {
+	return "-" + e.flag + "=" + e.value
+}
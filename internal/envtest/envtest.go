@@ -2,15 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// entryKey and sortEntries have been adapted from
-// src/cmd/go/internal/envcmd/env.go in the Go source distribution.
-// Copyright 2012 The Go Authors. All rights reserved.
-
 // Package envtest provides support for testing the env package.
 package envtest
 
 import (
-	"io"
 	"io/ioutil"
 	"os"
 	"sort"
@@ -53,9 +48,9 @@ func (f *File) Name() string {
 // The returned data is consistent with the data generated by the Encode
 // function.
 func (f *File) Read() string {
-	f.f.Seek(0, io.SeekStart)
-	data, err := ioutil.ReadAll(f.f)
-	if err != nil {
+	// The file is read by name, since the GOENV file may be replaced.
+	data, err := ioutil.ReadFile(f.f.Name())
+	if err != nil && !os.IsNotExist(err) {
 		f.t.Fatal(err)
 
 		// not reached.
@@ -82,43 +77,8 @@ func Keys(env map[string]string) []string {
 	return buf
 }
 
-// Encode encodes env in the same format used by go env -w, so that it is
+// Encode encodes vars in the same format used by go env -w, so that it is
 // compatible with the data read from File.Read.
-func Encode(env map[string]string) string {
-	buf := entries(env)
-
-	return strings.Join(buf, "\n")
-}
-
-// entries returns the sorted sequence of env entries.
-func entries(env map[string]string) []string {
-	buf := make([]string, 0, len(env))
-	for key, val := range env {
-		ent := key + "=" + val
-		buf = append(buf, ent)
-	}
-	sortEntries(buf)
-
-	return buf
-}
-
-// entryKey returns the KEY part of the entry KEY=VALUE or else an empty
-// string.
-func entryKey(entry string) string {
-	i := strings.Index(entry, "=")
-	if i < 0 {
-		return ""
-	}
-
-	return entry[:i]
-}
-
-// sortEntries sorts a sequence of entries by key.
-// It differs from sort.Strings in that GO386= sorts after GO=.
-//
-// sortEntries uses the same sorting algorithm used by go env.
-func sortEntries(entries []string) {
-	sort.Slice(entries, func(i, j int) bool {
-		return entryKey(entries[i]) < entryKey(entries[j])
-	})
+func Encode(vars map[string]string) string {
+	return strings.TrimSpace(string(env.Encode(vars)))
 }
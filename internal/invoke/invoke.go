@@ -8,11 +8,15 @@ package invoke
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"strings"
+
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
 )
 
 // Attr holds the attributes that will be applied to the cmd/go command.
@@ -27,13 +31,25 @@ type Attr struct {
 	// If Dir is the empty string, the cmd/go command runs in the calling
 	// process's current directory.
 	Dir string
+
+	// Runner specifies the runner used to run the cmd/go command.
+	// If Runner is nil, runner.Exec is used.
+	Runner runner.Runner
+
+	// Toolchain specifies the Go toolchain used to run the cmd/go command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	//
+	// When Toolchain is not nil, GOTOOLCHAIN is set to local, so that the
+	// cmd/go command will never switch to a different toolchain, and GOROOT
+	// is set to the toolchain GOROOT, so that a GOROOT in Env is not used.
+	Toolchain *toolchain.Toolchain
 }
 
 // Error is returned by Go in case the go command returns an error.
 type Error struct {
 	Argv   []string // arguments to the go command
 	Stderr []byte   // the entire content of the go command stderr
-	Err    error    // the original error from exec.Command.Run
+	Err    error    // the error from the runner, or *runner.ExitError wrapping *exec.ExitError
 }
 
 // Error implements the error interface.
@@ -63,39 +79,138 @@ func (e *Error) Unwrap() error {
 // empty stdout content and a nil error.  The stderr content will be ignored,
 // unless the GOCMDDEBUG environment variable is not empty, in which case it
 // will be logged using the log package.
+//
+// If the GOCMDRECORD environment variable is not empty, each invocation is
+// recorded in the transcript file it names, as described in the runner
+// package.
 func Go(verb string, argv []string, attr *Attr) ([]byte, error) {
-	argv = append([]string{verb}, argv...)
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
+	return GoContext(context.Background(), verb, argv, attr)
+}
+
+// GoContext is like Go but includes a context.
+//
+// If the context is done before the cmd/go command completes, the cmd/go
+// command and all the processes it started are killed.  The error will be of
+// type *Error, with the Err field set to ctx.Err() and the Stderr field set to
+// the stderr content written before the command was killed.
+func GoContext(ctx context.Context, verb string, argv []string, attr *Attr) ([]byte, error) {
+	return run(ctx, verb, argv, attr, nil)
+}
+
+// GoStream is like GoContext, but the stdout content is written to stdout as
+// it is produced by the cmd/go command, instead of being returned.
+//
+// If stdout blocks, the cmd/go command will block too.  To terminate the
+// cmd/go command early, the caller must cancel the context and make sure that
+// further writes to stdout fail, as an example by closing the reader side of
+// an io.Pipe.
+func GoStream(ctx context.Context, verb string, argv []string, attr *Attr, stdout io.Writer) error {
+	_, err := run(ctx, verb, argv, attr, stdout)
+
+	return err
+}
+
+// Version returns the version of the Go toolchain that runs the cmd/go
+// command with attr, as in go env GOVERSION.
+//
+// When attr.Toolchain is nil, Version returns an empty string unless resolve
+// is true, in which case go env GOVERSION is run with attr, since GOTOOLCHAIN
+// may select a toolchain different from the go command in $PATH.  Errors are
+// reported as an empty version too.
+func Version(ctx context.Context, attr *Attr, resolve bool) string {
+	if attr.Toolchain != nil {
+		return attr.Toolchain.Version
+	}
+	if !resolve {
+		return ""
+	}
+	stdout, err := GoContext(ctx, "env", []string{"GOVERSION"}, attr)
+	if err != nil {
+		return ""
+	}
 
-	cmd := exec.Command("go", argv...)
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+	return strings.TrimSpace(string(stdout))
+}
+
+// run invokes a cmd/go command.  If stdout is not nil, the stdout content is
+// written to it.
+func run(ctx context.Context, verb string, argv []string, attr *Attr, stdout io.Writer) ([]byte, error) {
+	argv = append([]string{verb}, argv...)
+	inv := runner.Invocation{
+		Argv:   argv,
+		Stdout: stdout,
+	}
+	var r runner.Runner = runner.Exec{}
 	if attr != nil {
-		cmd.Dir = attr.Dir
-		cmd.Env = attr.Env
+		inv.Dir = attr.Dir
+		inv.Env = attr.Env
+		if attr.Runner != nil {
+			r = attr.Runner
+		}
+		if t := attr.Toolchain; t != nil {
+			inv.Path = t.Path
+			inv.Env = Setenv(inv.Env, "GOTOOLCHAIN", "local")
+			inv.Env = Setenv(inv.Env, "GOROOT", t.GOROOT)
+		}
+	}
+
+	if path := os.Getenv("GOCMDRECORD"); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			log.Printf("GOCMDRECORD: %v", err)
+		} else {
+			defer f.Close()
+			r = runner.NewRecorder(f, r)
+		}
 	}
 
-	if err := cmd.Run(); err != nil {
+	res, err := r.Run(ctx, &inv)
+	if res == nil {
+		res = new(runner.Result)
+	}
+	if stdout != nil && len(res.Stdout) > 0 {
+		// The runner does not support streaming.
+		if _, werr := stdout.Write(res.Stdout); werr != nil && err == nil {
+			err = werr
+		}
+		res.Stdout = nil
+	}
+	if err == nil && res.ExitCode != 0 {
+		err = &runner.ExitError{ExitCode: res.ExitCode, Err: res.ExitErr}
+	}
+	if err != nil {
 		// Just return the error, including the non empty stderr output as is.
 		// Make sure to also return the stdout content, since it may be
 		// important.  But only if it is not empty.
 		var buf []byte
-		if stdout.Len() > 0 {
-			buf = stdout.Bytes()
+		if len(res.Stdout) > 0 {
+			buf = res.Stdout
 		}
 		err := &Error{
 			Argv:   argv,
-			Stderr: stderr.Bytes(),
+			Stderr: res.Stderr,
 			Err:    err,
 		}
 
 		return buf, err
 	}
-	if stderr.Len() != 0 && os.Getenv("GOCMDDEBUG") != "" {
+	if len(res.Stderr) != 0 && os.Getenv("GOCMDDEBUG") != "" {
 		argv := strings.Trim(fmt.Sprint(argv), "[]")
-		log.Printf("go %v: %s", argv, stderr)
+		log.Printf("go %v: %s", argv, res.Stderr)
+	}
+
+	return res.Stdout, nil
+}
+
+// Setenv returns a copy of env with key set to value.  If env is nil, the
+// current process's environment is used.
+func Setenv(env []string, key, value string) []string {
+	if env == nil {
+		env = os.Environ()
 	}
+	buf := make([]string, 0, len(env)+1)
+	buf = append(buf, env...)
 
-	return stdout.Bytes(), nil
+	// The last entry takes precedence.
+	return append(buf, key+"="+value)
 }
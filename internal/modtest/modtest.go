@@ -0,0 +1,36 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package modtest provides support for testing with Go modules.
+package modtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// NewModule creates a module in a temporary directory, with the specified
+// files, and returns the directory.  The file names are slash separated
+// paths, relative to the directory.
+//
+// The caller is responsible for removing the directory.
+func NewModule(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gocmd-module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
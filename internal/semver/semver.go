@@ -0,0 +1,264 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The semver package has been adapted from golang.org/x/mod/semver.
+// Copyright 2018 The Go Authors. All rights reserved.
+
+// Package semver implements the subset of semantic versioning used by Go
+// modules.
+//
+// Versions must start with a v, as in v1.2.3.  The shorthands v1 and v1.2 are
+// accepted as aliases for v1.0.0 and v1.2.0.
+package semver
+
+import (
+	"strings"
+)
+
+type version struct {
+	major, minor, patch string
+	prerelease          string
+	build               string
+}
+
+// IsValid reports whether v is a valid semantic version.
+func IsValid(v string) bool {
+	_, ok := parse(v)
+
+	return ok
+}
+
+// Major returns the major version prefix of v, as in v2 for v2.1.0.  If v is
+// not valid, Major returns the empty string.
+func Major(v string) string {
+	p, ok := parse(v)
+	if !ok {
+		return ""
+	}
+
+	return "v" + p.major
+}
+
+// MajorMinor returns the major.minor version prefix of v, as in v2.1 for
+// v2.1.0.  If v is not valid, MajorMinor returns the empty string.
+func MajorMinor(v string) string {
+	p, ok := parse(v)
+	if !ok {
+		return ""
+	}
+
+	return "v" + p.major + "." + p.minor
+}
+
+// Prerelease returns the prerelease suffix of v, including the leading minus,
+// as in -rc.1 for v1.2.0-rc.1.
+func Prerelease(v string) string {
+	p, _ := parse(v)
+
+	return p.prerelease
+}
+
+// Build returns the build suffix of v, including the leading plus, as in
+// +incompatible for v2.0.0+incompatible.
+func Build(v string) string {
+	p, _ := parse(v)
+
+	return p.build
+}
+
+// Compare returns an integer comparing two versions according to semantic
+// version precedence.  The result will be 0 if v == w, -1 if v < w, or +1 if
+// v > w.
+//
+// An invalid version is considered less than a valid one, and all invalid
+// versions are equal.
+func Compare(v, w string) int {
+	pv, ok1 := parse(v)
+	pw, ok2 := parse(w)
+	if !ok1 && !ok2 {
+		return 0
+	}
+	if !ok1 {
+		return -1
+	}
+	if !ok2 {
+		return +1
+	}
+	if c := compareInt(pv.major, pw.major); c != 0 {
+		return c
+	}
+	if c := compareInt(pv.minor, pw.minor); c != 0 {
+		return c
+	}
+	if c := compareInt(pv.patch, pw.patch); c != 0 {
+		return c
+	}
+
+	return comparePrerelease(pv.prerelease, pw.prerelease)
+}
+
+// Max returns the maximum of v and w.
+func Max(v, w string) string {
+	if Compare(v, w) < 0 {
+		return w
+	}
+
+	return v
+}
+
+func parse(v string) (p version, ok bool) {
+	if v == "" || v[0] != 'v' {
+		return p, false
+	}
+	if p.major, v, ok = parseInt(v[1:]); !ok {
+		return p, false
+	}
+	if v == "" {
+		p.minor, p.patch = "0", "0"
+
+		return p, true
+	}
+	if v[0] != '.' {
+		return p, false
+	}
+	if p.minor, v, ok = parseInt(v[1:]); !ok {
+		return p, false
+	}
+	if v == "" {
+		p.patch = "0"
+
+		return p, true
+	}
+	if v[0] != '.' {
+		return p, false
+	}
+	if p.patch, v, ok = parseInt(v[1:]); !ok {
+		return p, false
+	}
+	if strings.HasPrefix(v, "-") {
+		i := strings.IndexByte(v, '+')
+		if i < 0 {
+			i = len(v)
+		}
+		p.prerelease, v = v[:i], v[i:]
+		if !isIdentList(p.prerelease[1:], true) {
+			return p, false
+		}
+	}
+	if strings.HasPrefix(v, "+") {
+		p.build, v = v, ""
+		if !isIdentList(p.build[1:], false) {
+			return p, false
+		}
+	}
+	if v != "" {
+		return p, false
+	}
+
+	return p, true
+}
+
+func parseInt(v string) (t, rest string, ok bool) {
+	i := 0
+	for i < len(v) && '0' <= v[i] && v[i] <= '9' {
+		i++
+	}
+	if i == 0 || (v[0] == '0' && i != 1) {
+		return "", "", false
+	}
+
+	return v[:i], v[i:], true
+}
+
+func isIdentList(s string, prerelease bool) bool {
+	if s == "" {
+		return false
+	}
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for i := 0; i < len(id); i++ {
+			c := id[i]
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+		if prerelease && isNum(id) && id[0] == '0' && len(id) > 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNum(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+func compareInt(x, y string) int {
+	if x == y {
+		return 0
+	}
+	if len(x) < len(y) {
+		return -1
+	}
+	if len(x) > len(y) {
+		return +1
+	}
+	if x < y {
+		return -1
+	}
+
+	return +1
+}
+
+func comparePrerelease(x, y string) int {
+	// A version without prerelease has higher precedence.
+	if x == y {
+		return 0
+	}
+	if x == "" {
+		return +1
+	}
+	if y == "" {
+		return -1
+	}
+
+	xs := strings.Split(x[1:], ".")
+	ys := strings.Split(y[1:], ".")
+	for i := 0; i < len(xs) && i < len(ys); i++ {
+		dx, dy := xs[i], ys[i]
+		if dx == dy {
+			continue
+		}
+		nx, ny := isNum(dx), isNum(dy)
+		switch {
+		case nx && ny:
+			return compareInt(dx, dy)
+		case nx:
+			return -1
+		case ny:
+			return +1
+		case dx < dy:
+			return -1
+		default:
+			return +1
+		}
+	}
+	switch {
+	case len(xs) < len(ys):
+		return -1
+	case len(xs) > len(ys):
+		return +1
+	}
+
+	return 0
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semver
+
+import (
+	"testing"
+)
+
+// TestCompare tests the Compare function.
+func TestCompare(t *testing.T) {
+	// Sorted by increasing precedence.
+	versions := []string{
+		"bad",
+		"v0.0.0-20190101000000-abcdefabcdef",
+		"v0.1.0",
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.2.0",
+		"v1.10.0",
+		"v2.0.0+incompatible",
+	}
+
+	for i, v := range versions {
+		for j, w := range versions {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = +1
+			}
+			if got := Compare(v, w); got != want {
+				t.Errorf("Compare(%q, %q): got %d, want %d", v, w, got, want)
+			}
+		}
+	}
+}
+
+// TestMajorMinor tests the Major and MajorMinor functions.
+func TestMajorMinor(t *testing.T) {
+	var tests = []struct {
+		v            string
+		major, minor string
+	}{
+		{"v1.2.3", "v1", "v1.2"},
+		{"v2", "v2", "v2.0"},
+		{"v0.0.0-20190101000000-abcdefabcdef", "v0", "v0.0"},
+		{"1.2.3", "", ""},
+		{"v01.2.3", "", ""},
+	}
+
+	for _, test := range tests {
+		if got := Major(test.v); got != test.major {
+			t.Errorf("Major(%q): got %q, want %q", test.v, got, test.major)
+		}
+		if got := MajorMinor(test.v); got != test.minor {
+			t.Errorf("MajorMinor(%q): got %q, want %q", test.v, got, test.minor)
+		}
+	}
+}
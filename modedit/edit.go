@@ -0,0 +1,96 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modedit
+
+import (
+	"github.com/perillo/gocmd/internal/edit"
+)
+
+// Edit is an editing operation, corresponding to one of the go mod edit
+// editing flags.  Its String method returns the edit as a go mod edit flag.
+//
+// The SetGo, SetToolchain, AddGodebug, DropGodebug, AddReplace and
+// DropReplace edits can be used with go work edit too.
+type Edit = edit.Edit
+
+// SetModule changes the module path.
+func SetModule(path string) Edit {
+	return edit.New("module", path)
+}
+
+// SetGo sets the go directive to version.  The version "none" removes the go
+// directive.
+func SetGo(version string) Edit {
+	return edit.New("go", version)
+}
+
+// SetToolchain sets the toolchain directive to name, like "go1.21.0".  The
+// name "none" removes the toolchain directive.
+func SetToolchain(name string) Edit {
+	return edit.New("toolchain", name)
+}
+
+// AddGodebug adds a godebug key=value setting, replacing any existing
+// setting with the same key.
+func AddGodebug(key, value string) Edit {
+	return edit.New("godebug", key+"="+value)
+}
+
+// DropGodebug drops the godebug setting with the key.
+func DropGodebug(key string) Edit {
+	return edit.New("dropgodebug", key)
+}
+
+// AddRequire adds a requirement on the module path and version, overriding
+// any existing requirement on path.
+func AddRequire(path, version string) Edit {
+	return edit.New("require", path+"@"+version)
+}
+
+// DropRequire drops the requirement on the module path.
+func DropRequire(path string) Edit {
+	return edit.New("droprequire", path)
+}
+
+// AddExclude adds an exclusion for the module version.
+func AddExclude(m Module) Edit {
+	return edit.New("exclude", m.String())
+}
+
+// DropExclude drops the exclusion for the module version.
+func DropExclude(m Module) Edit {
+	return edit.New("dropexclude", m.String())
+}
+
+// AddReplace adds a replacement of the old module with the new module.
+func AddReplace(old, new Module) Edit {
+	return edit.New("replace", old.String()+"="+new.String())
+}
+
+// DropReplace drops the replacement of the old module.
+func DropReplace(old Module) Edit {
+	return edit.New("dropreplace", old.String())
+}
+
+// AddRetract adds a retraction.  The rationale can not be set by go mod edit
+// and it is ignored.
+func AddRetract(r Retract) Edit {
+	return edit.New("retract", r.interval())
+}
+
+// DropRetract drops a retraction.
+func DropRetract(r Retract) Edit {
+	return edit.New("dropretract", r.interval())
+}
+
+// interval returns r as a single version or as a closed interval, as expected
+// by the -retract and -dropretract flags.
+func (r Retract) interval() string {
+	if r.High == "" || r.Low == r.High {
+		return r.Low
+	}
+
+	return "[" + r.Low + "," + r.High + "]"
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modedit
+
+// GoMod represents a go.mod file, as reported by go mod edit -json.
+type GoMod struct {
+	Module    ModPath
+	Go        string    // go directive
+	Toolchain string    // toolchain directive
+	Godebug   []Godebug // godebug directives
+	Require   []Require
+	Exclude   []Module
+	Replace   []Replace
+	Retract   []Retract
+	Tool      []Tool
+	Ignore    []Ignore
+}
+
+// Module is a module path and version.
+type Module struct {
+	Path    string
+	Version string `json:",omitempty"`
+}
+
+// String returns the module in the path@version form, or path when the
+// version is empty.
+func (m Module) String() string {
+	if m.Version == "" {
+		return m.Path
+	}
+
+	return m.Path + "@" + m.Version
+}
+
+// ModPath is the module directive.
+type ModPath struct {
+	Path       string
+	Deprecated string `json:",omitempty"` // deprecation message
+}
+
+// Godebug is a godebug key=value setting.
+type Godebug struct {
+	Key   string
+	Value string
+}
+
+// Require is a module requirement.
+type Require struct {
+	Path     string
+	Version  string
+	Indirect bool `json:",omitempty"` // has "// indirect" comment
+}
+
+// Replace is a module replacement.  When Old.Version is empty, the
+// replacement applies to all the versions of Old.Path.  When New.Version is
+// empty, New.Path is a local module root directory.
+type Replace struct {
+	Old Module
+	New Module
+}
+
+// Retract is a retracted version interval.  A single retracted version has
+// Low and High set to the same value.
+type Retract struct {
+	Low       string
+	High      string
+	Rationale string `json:",omitempty"`
+}
+
+// Tool is a tool declaration.
+type Tool struct {
+	Path string
+}
+
+// Ignore is an ignore declaration.
+type Ignore struct {
+	Path string
+}
+
+// Requirement returns the requirement on the module path, or nil if the
+// module is not required.
+func (f *GoMod) Requirement(path string) *Require {
+	for i := range f.Require {
+		if f.Require[i].Path == path {
+			return &f.Require[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package modedit is a wrapper for the go mod edit command.
+package modedit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
+)
+
+// Error is returned by Load and Apply in case the go command returns an
+// error.
+type Error = invoke.Error
+
+// Editor is used to provide custom options for reading and editing a go.mod
+// file.
+type Editor struct {
+	// Dir is the directory in which to run the go mod edit command.
+	// If Dir is empty, go mod edit is run in the current directory.
+	Dir string
+
+	// Env is the environment to use when invoking go mod edit.
+	// If Env is nil, the current environment is used.
+	Env []string
+
+	// Runner is the runner used to run the go mod edit command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go mod edit command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+
+	// File is the path of the go.mod file to edit, relative to Dir.
+	// If File is empty, the go.mod file of the main module is used.
+	File string
+}
+
+// Load reads and returns the go.mod file, with the specified edits applied.
+// The go.mod file is not modified.
+//
+// If the go.mod file cannot be loaded, Load returns a nil GoMod and an error
+// of type *Error.
+func (e *Editor) Load(edits ...Edit) (*GoMod, error) {
+	return e.LoadContext(context.Background(), edits...)
+}
+
+// LoadContext is like Load but includes a context.
+func (e *Editor) LoadContext(ctx context.Context, edits ...Edit) (*GoMod, error) {
+	argv := e.argv("-json", edits)
+	stdout, err := invoke.GoContext(ctx, "mod", argv, e.attr())
+	if err != nil {
+		return nil, fmt.Errorf("modedit: load: %w", err)
+	}
+
+	gomod := new(GoMod)
+	if err := json.Unmarshal(stdout, gomod); err != nil {
+		return nil, fmt.Errorf("modedit: load: JSON unmarshal: %w", err)
+	}
+
+	return gomod, nil
+}
+
+// Apply applies the specified edits, in order, and writes the go.mod file.
+// Apply does not look up information about the modules involved, so the
+// go.mod file may be left inconsistent with the module graph.
+//
+// If the go.mod file cannot be edited, Apply returns an error of type *Error
+// and the go.mod file is not modified.
+func (e *Editor) Apply(edits ...Edit) error {
+	return e.ApplyContext(context.Background(), edits...)
+}
+
+// ApplyContext is like Apply but includes a context.
+func (e *Editor) ApplyContext(ctx context.Context, edits ...Edit) error {
+	if len(edits) == 0 {
+		return nil
+	}
+	argv := e.argv("", edits)
+	if _, err := invoke.GoContext(ctx, "mod", argv, e.attr()); err != nil {
+		return fmt.Errorf("modedit: apply: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Editor) attr() *invoke.Attr {
+	attr := invoke.Attr{
+		Dir:       e.Dir,
+		Env:       e.Env,
+		Runner:    e.Runner,
+		Toolchain: e.Toolchain,
+	}
+
+	return &attr
+}
+
+// argv returns the go mod edit arguments, with the optional output flag.
+func (e *Editor) argv(output string, edits []Edit) []string {
+	argv := []string{"edit"}
+	if output != "" {
+		argv = append(argv, output)
+	}
+	for _, edit := range edits {
+		argv = append(argv, edit.String())
+	}
+	if e.File != "" {
+		argv = append(argv, e.File)
+	}
+
+	return argv
+}
+
+// Load reads and returns the go.mod file of the main module, using the
+// default editor configuration.
+//
+// If the go.mod file cannot be loaded, Load returns a nil GoMod and an error
+// of type *Error.
+func Load() (*GoMod, error) {
+	var e Editor
+
+	return e.Load()
+}
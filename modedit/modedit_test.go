@@ -0,0 +1,187 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modedit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/perillo/gocmd/internal/modtest"
+)
+
+const gomod = `module example.com/m
+
+go 1.16
+
+require (
+	golang.org/x/text v0.3.0
+	gopkg.in/yaml.v2 v2.2.1 // indirect
+)
+
+retract v1.0.0
+`
+
+// mkmodule creates a temporary module with the go.mod file.
+func mkmodule(t *testing.T) string {
+	return modtest.NewModule(t, map[string]string{"go.mod": gomod})
+}
+
+// read returns the content of the go.mod file in dir.
+func read(t *testing.T, dir string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// TestLoad tests that the Load function decodes the go.mod file.
+func TestLoad(t *testing.T) {
+	dir := mkmodule(t)
+	defer os.RemoveAll(dir)
+
+	e := Editor{
+		Dir: dir,
+	}
+	got, err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &GoMod{
+		Module: ModPath{Path: "example.com/m"},
+		Go:     "1.16",
+		Require: []Require{
+			{Path: "golang.org/x/text", Version: "v0.3.0"},
+			{Path: "gopkg.in/yaml.v2", Version: "v2.2.1", Indirect: true},
+		},
+		Retract: []Retract{
+			{Low: "v1.0.0", High: "v1.0.0"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("load: got %+v, want %+v", got, want)
+	}
+	if r := got.Requirement("gopkg.in/yaml.v2"); r == nil || !r.Indirect {
+		t.Errorf("requirement: got %+v", r)
+	}
+}
+
+// TestLoadEdits tests that the Load function applies the edits without
+// modifying the go.mod file.
+func TestLoadEdits(t *testing.T) {
+	dir := mkmodule(t)
+	defer os.RemoveAll(dir)
+
+	e := Editor{
+		Dir: dir,
+	}
+	got, err := e.Load(DropRequire("gopkg.in/yaml.v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Require) != 1 {
+		t.Errorf("load: expected 1 requirement, got %+v", got.Require)
+	}
+	if data := read(t, dir); data != gomod {
+		t.Errorf("go.mod: expected unchanged, got %q", data)
+	}
+}
+
+// TestApply tests that the Apply function edits the go.mod file.
+func TestApply(t *testing.T) {
+	dir := mkmodule(t)
+	defer os.RemoveAll(dir)
+
+	e := Editor{
+		Dir: dir,
+	}
+	err := e.Apply(
+		SetGo("1.21"),
+		SetToolchain("go1.21.1"),
+		AddGodebug("panicnil", "1"),
+		AddRequire("golang.org/x/text", "v0.3.7"),
+		DropRequire("gopkg.in/yaml.v2"),
+		AddExclude(Module{Path: "golang.org/x/text", Version: "v0.3.5"}),
+		AddReplace(Module{Path: "golang.org/x/text"}, Module{Path: "../text"}),
+		AddRetract(Retract{Low: "v1.1.0", High: "v1.1.9"}),
+		DropRetract(Retract{Low: "v1.0.0"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &GoMod{
+		Module:    ModPath{Path: "example.com/m"},
+		Go:        "1.21",
+		Toolchain: "go1.21.1",
+		Godebug: []Godebug{
+			{Key: "panicnil", Value: "1"},
+		},
+		Require: []Require{
+			{Path: "golang.org/x/text", Version: "v0.3.7"},
+		},
+		Exclude: []Module{
+			{Path: "golang.org/x/text", Version: "v0.3.5"},
+		},
+		Replace: []Replace{
+			{Old: Module{Path: "golang.org/x/text"}, New: Module{Path: "../text"}},
+		},
+		Retract: []Retract{
+			{Low: "v1.1.0", High: "v1.1.9"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("load: got %+v, want %+v", got, want)
+	}
+}
+
+// TestApplyFail tests that the Apply function in case of failure returns an
+// error of type *Error and does not modify the go.mod file.
+func TestApplyFail(t *testing.T) {
+	dir := mkmodule(t)
+	defer os.RemoveAll(dir)
+
+	e := Editor{
+		Dir: dir,
+	}
+	err := e.Apply(DropRequire("gopkg.in/yaml.v2"), SetGo("xxx"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var ee *Error
+	if !errors.As(err, &ee) {
+		t.Errorf("expected an error of type *Error, got %v", err)
+	}
+	if data := read(t, dir); data != gomod {
+		t.Errorf("go.mod: expected unchanged, got %q", data)
+	}
+}
+
+// TestFile tests the File option.
+func TestFile(t *testing.T) {
+	dir := mkmodule(t)
+	defer os.RemoveAll(dir)
+
+	e := Editor{
+		Dir:  os.TempDir(),
+		File: filepath.Join(dir, "go.mod"),
+	}
+	got, err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Module.Path != "example.com/m" {
+		t.Errorf("load: got module %q", got.Module.Path)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modfetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/invoke"
+)
+
+// Errors reported in FileError.
+var (
+	ErrOutsideCache = errors.New("not in the module cache")
+	ErrFileType     = errors.New("wrong file type")
+	ErrVersion      = errors.New("version mismatch")
+)
+
+// FileError reports an inconsistency between a module and a file in the
+// module cache.
+type FileError struct {
+	Module *Module
+	Field  string // the Module field: Info, GoMod, Zip or Dir
+	Path   string
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *FileError) Error() string {
+	return e.Module.String() + ": " + e.Field + " " + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// CheckError is returned by Load, when the Check or ReadInfo option is set,
+// in case one or more modules are inconsistent with the module cache.
+type CheckError struct {
+	Errors []*FileError
+}
+
+// Error implements the error interface.
+func (e *CheckError) Error() string {
+	buf := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		buf = append(buf, err.Error())
+	}
+
+	return fmt.Sprintf("%d inconsistent files: %s", len(e.Errors), strings.Join(buf, "; "))
+}
+
+// check checks the modules against the module cache, and reads the .info
+// files when ReadInfo is true.
+func (l *Loader) check(ctx context.Context, attr *invoke.Attr, modlist []*Module) error {
+	var cache string
+	if l.Check {
+		stdout, err := invoke.GoContext(ctx, "env", []string{"GOMODCACHE"}, attr)
+		if err != nil {
+			return err
+		}
+		cache = string(bytes.TrimSpace(stdout))
+	}
+
+	var errs []*FileError
+	for _, mod := range modlist {
+		if mod.Error != nil {
+			continue
+		}
+		if l.Check {
+			errs = append(errs, checkFiles(cache, mod)...)
+		}
+		if l.ReadInfo {
+			if err := readInfo(mod); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if errs != nil {
+		return &CheckError{Errors: errs}
+	}
+
+	return nil
+}
+
+// checkFiles checks that the module files exist in the module cache, with
+// the correct type.
+func checkFiles(cache string, mod *Module) []*FileError {
+	files := []struct {
+		field string
+		path  string
+		dir   bool
+	}{
+		{"Info", mod.Info, false},
+		{"GoMod", mod.GoMod, false},
+		{"Zip", mod.Zip, false},
+		{"Dir", mod.Dir, true},
+	}
+
+	var errs []*FileError
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if err := checkFile(cache, f.path, f.dir); err != nil {
+			e := &FileError{
+				Module: mod,
+				Field:  f.field,
+				Path:   f.path,
+				Err:    err,
+			}
+			errs = append(errs, e)
+		}
+	}
+
+	return errs
+}
+
+// checkFile checks that path is in the module cache, and that it is a
+// directory when dir is true or a regular file otherwise.
+func checkFile(cache, path string, dir bool) error {
+	rel, err := filepath.Rel(cache, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ErrOutsideCache
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		// Report the underlying error, since the path is already available.
+		if e, ok := err.(*os.PathError); ok {
+			return e.Err
+		}
+
+		return err
+	}
+	if fi.IsDir() != dir {
+		return ErrFileType
+	}
+
+	return nil
+}
+
+// readInfo reads the .info file of the module into InfoData.
+func readInfo(mod *Module) *FileError {
+	fail := func(err error) *FileError {
+		return &FileError{
+			Module: mod,
+			Field:  "Info",
+			Path:   mod.Info,
+			Err:    err,
+		}
+	}
+
+	if mod.Info == "" {
+		return fail(os.ErrNotExist)
+	}
+	data, err := ioutil.ReadFile(mod.Info)
+	if err != nil {
+		return fail(err)
+	}
+	info := new(Info)
+	if err := json.Unmarshal(data, info); err != nil {
+		return fail(err)
+	}
+	if info.Version != mod.Version {
+		return fail(ErrVersion)
+	}
+	mod.InfoData = info
+
+	return nil
+}
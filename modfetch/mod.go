@@ -4,6 +4,12 @@
 
 package modfetch
 
+import (
+	"time"
+
+	"github.com/perillo/gocmd/modlist"
+)
+
 // For the actual definition of moduleJSON, see
 // src/cmd/go/internal/modcmd/download.go.
 
@@ -11,28 +17,48 @@ package modfetch
 // It has the problem that the Error field is defined as a string, and not as a
 // ModuleError, thus preventing the error to be easily wrapped.
 type moduleJSON struct {
-	Path     string `json:",omitempty"` // module path
-	Version  string `json:",omitempty"` // module version
-	Error    string `json:",omitempty"` // error loading module
-	Info     string `json:",omitempty"` // absolute path to cached .info file
-	GoMod    string `json:",omitempty"` // absolute path to cached .mod file
-	Zip      string `json:",omitempty"` // absolute path to cached .zip file
-	Dir      string `json:",omitempty"` // absolute path to cached source root directory
-	Sum      string `json:",omitempty"` // checksum for path, version (as in go.sum)
-	GoModSum string `json:",omitempty"` // checksum for go.mod (as in go.sum)
+	Path     string  `json:",omitempty"` // module path
+	Version  string  `json:",omitempty"` // module version
+	Query    string  `json:",omitempty"` // version query corresponding to this version
+	Error    string  `json:",omitempty"` // error loading module
+	Info     string  `json:",omitempty"` // absolute path to cached .info file
+	GoMod    string  `json:",omitempty"` // absolute path to cached .mod file
+	Zip      string  `json:",omitempty"` // absolute path to cached .zip file
+	Dir      string  `json:",omitempty"` // absolute path to cached source root directory
+	Sum      string  `json:",omitempty"` // checksum for path, version (as in go.sum)
+	GoModSum string  `json:",omitempty"` // checksum for go.mod (as in go.sum)
+	Origin   *Origin `json:",omitempty"` // provenance of module
+	Reuse    bool    `json:",omitempty"` // reuse of old module info is safe
 }
 
 // Module represents a cached module.
 type Module struct {
 	Path     string       `json:",omitempty"` // module path
 	Version  string       `json:",omitempty"` // module version
+	Query    string       `json:",omitempty"` // version query corresponding to this version
 	Info     string       `json:",omitempty"` // absolute path to cached .info file
 	GoMod    string       `json:",omitempty"` // absolute path to cached .mod file
 	Zip      string       `json:",omitempty"` // absolute path to cached .zip file
 	Dir      string       `json:",omitempty"` // absolute path to cached source root directory
 	Sum      string       `json:",omitempty"` // checksum for path, version (as in go.sum)
 	GoModSum string       `json:",omitempty"` // checksum for go.mod (as in go.sum)
+	Origin   *Origin      `json:",omitempty"` // provenance of module
+	Reuse    bool         `json:",omitempty"` // reuse of old module info is safe
 	Error    *ModuleError `json:",omitempty"` // error loading module
+
+	// Information not reported by go mod download
+	InfoData  *Info  `json:",omitempty"` // content of the .info file (with Loader.ReadInfo)
+	Toolchain string `json:",omitempty"` // version of the Go toolchain that fetched this module, if known
+}
+
+// Origin describes the provenance of a module version.
+type Origin = modlist.Origin
+
+// Info is the content of the cached .info file.
+type Info struct {
+	Version string    // version string
+	Time    time.Time // commit time
+	Origin  *Origin   `json:",omitempty"` // provenance of module
 }
 
 // String implements the Stringer interface.
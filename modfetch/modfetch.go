@@ -7,11 +7,14 @@ package modfetch
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
 )
 
 // Error is returned by Load in case the go command returns an error.
@@ -26,6 +29,34 @@ type Loader struct {
 	// Env is the environment to use when invoking go mod download.
 	// If Env is nil, the current environment is used.
 	Env []string
+
+	// Runner is the runner used to run the go mod download command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go mod download command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+
+	// ResolveToolchain, when true and Toolchain is nil, causes go env
+	// GOVERSION to be run too, so that the Toolchain field of each module
+	// records the version of the go command in $PATH, or of the one selected
+	// by GOTOOLCHAIN.
+	ResolveToolchain bool
+
+	// GOWORK is the go.work file to use, by setting GOWORK.  It can be set to
+	// "off" to disable workspace mode.  If empty, the value from Env is used.
+	GOWORK string
+
+	// Check, when true, causes Load to check that the Info, GoMod, Zip and Dir
+	// paths of each module exist in the module cache, as reported by go env
+	// GOMODCACHE.  Inconsistencies are reported with an error of type
+	// *CheckError.
+	Check bool
+
+	// ReadInfo, when true, causes Load to read the .info file of each module
+	// into InfoData, and to check that it reports the same version.
+	ReadInfo bool
 }
 
 // Load downloads and returns the Go modules named by the given patterns.
@@ -34,20 +65,39 @@ type Loader struct {
 // If one or more modules cannot be loaded, Load returns a nil slice and an
 // error of type *Error.  If Load returns successfully, the returned modules
 // have all been correctly loaded.
+//
+// When Check or ReadInfo is true and the returned modules are inconsistent
+// with the module cache, Load returns a nil slice and an error of type
+// *CheckError.
 func (l *Loader) Load(patterns ...string) ([]*Module, error) {
+	return l.LoadContext(context.Background(), patterns...)
+}
+
+// LoadContext is like Load but includes a context.
+//
+// If the context is done before loading completes, the go mod download
+// command is killed and LoadContext returns a nil slice and an error of type
+// *Error that wraps ctx.Err().
+func (l *Loader) LoadContext(ctx context.Context, patterns ...string) ([]*Module, error) {
 	attr := invoke.Attr{
-		Dir: l.Dir,
-		Env: l.Env,
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
 	}
 	argv := []string{"download", "-json"}
 	argv = append(argv, patterns...)
 
-	stdout, err := invoke.Go("mod", argv, &attr)
+	stdout, err := invoke.GoContext(ctx, "mod", argv, &attr)
 	if err != nil {
 		// go mod download -json does not reports errors on stderr, so we need
 		// to collect them from stdout in order to offer a consistent api.
+		// Keep the original stderr when there is nothing to collect, as an
+		// example when the command has been killed.
 		err := err.(*Error)
-		err.Stderr = []byte(collect(stdout))
+		if msg := collect(stdout); msg != "" {
+			err.Stderr = []byte(msg)
+		}
 
 		return nil, fmt.Errorf("modfetch: load: %w", err)
 	}
@@ -56,6 +106,16 @@ func (l *Loader) Load(patterns ...string) ([]*Module, error) {
 	if err != nil {
 		return nil, fmt.Errorf("modfetch: load: %w", err)
 	}
+	if v := invoke.Version(ctx, &attr, l.ResolveToolchain); v != "" {
+		for _, mod := range modlist {
+			mod.Toolchain = v
+		}
+	}
+	if l.Check || l.ReadInfo {
+		if err := l.check(ctx, &attr, modlist); err != nil {
+			return nil, fmt.Errorf("modfetch: load: %w", err)
+		}
+	}
 
 	return modlist, nil
 }
@@ -73,6 +133,15 @@ func Load(patterns ...string) ([]*Module, error) {
 	return l.Load(patterns...)
 }
 
+// environ returns the environment corresponding to the loader options.
+func (l *Loader) environ() []string {
+	if l.GOWORK != "" {
+		return invoke.Setenv(l.Env, "GOWORK", l.GOWORK)
+	}
+
+	return l.Env
+}
+
 // collect collects and return all the errors reported by invoke.Go and stored
 // in the Module.Error field.
 //
@@ -117,12 +186,15 @@ func fromInternal(mod *moduleJSON) *Module {
 	r := new(Module)
 	r.Path = mod.Path
 	r.Version = mod.Version
+	r.Query = mod.Query
 	r.Info = mod.Info
 	r.GoMod = mod.GoMod
 	r.Zip = mod.Zip
-	r.Dir = mod.Zip
+	r.Dir = mod.Dir
 	r.Sum = mod.Sum
 	r.GoModSum = mod.GoModSum
+	r.Origin = mod.Origin
+	r.Reuse = mod.Reuse
 	if mod.Error != "" {
 		r.Error = &ModuleError{Err: mod.Error}
 	}
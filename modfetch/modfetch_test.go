@@ -5,10 +5,20 @@
 package modfetch
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/perillo/gocmd/runner"
 )
 
 // TestLoad tests that the Load function works correctly.
@@ -31,6 +41,89 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+// TestLoadDir tests that the Load function reports the source root directory
+// in Dir, and not the zip file.
+func TestLoadDir(t *testing.T) {
+	l := Loader{
+		Dir:      os.TempDir(),
+		Check:    true,
+		ReadInfo: true,
+	}
+
+	mods, err := l.Load("golang.org/x/text@v0.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := mods[0]
+	if mod.Dir == mod.Zip {
+		t.Errorf("load: Dir is the zip file %q", mod.Dir)
+	}
+	if fi, err := os.Stat(mod.Dir); err != nil || !fi.IsDir() {
+		t.Errorf("load: Dir %q is not a directory", mod.Dir)
+	}
+	if mod.InfoData == nil || mod.InfoData.Version != mod.Version {
+		t.Errorf("load: got info %+v", mod.InfoData)
+	}
+}
+
+// TestLoadCheck tests that the Load function, with the Check and ReadInfo
+// options set, reports the inconsistencies with the module cache.
+func TestLoadCheck(t *testing.T) {
+	modcache, err := ioutil.TempDir("", "gocmd-modcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(modcache)
+	info := filepath.Join(modcache, "x.info")
+	if err := ioutil.WriteFile(info, []byte(`{"Version":"v1.1.0"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := map[string]string{
+		"Path":    "example.com/x",
+		"Version": "v1.0.0",
+		"Info":    info,
+		"Zip":     filepath.Join(modcache, "x.zip"),
+		"Dir":     os.TempDir(),
+	}
+	l := Loader{
+		Check:    true,
+		ReadInfo: true,
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			res := new(runner.Result)
+			if inv.Argv[0] == "env" {
+				res.Stdout = []byte(modcache + "\n")
+			} else {
+				res.Stdout, _ = json.Marshal(mod)
+			}
+
+			return res, nil
+		}),
+	}
+
+	mods, err := l.Load("example.com/x@v1.0.0")
+	if mods != nil {
+		t.Errorf("expected the data to be nil, got %v", mods)
+	}
+	var e *CheckError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an error of type *CheckError, got %v", err)
+	}
+	want := map[string]error{
+		"Zip":  os.ErrNotExist,
+		"Dir":  ErrOutsideCache,
+		"Info": ErrVersion,
+	}
+	if len(e.Errors) != len(want) {
+		t.Fatalf("check: expected %d errors, got %v", len(want), e)
+	}
+	for _, err := range e.Errors {
+		if !errors.Is(err, want[err.Field]) {
+			t.Errorf("check %s: got %v, want %v", err.Field, err.Err, want[err.Field])
+		}
+	}
+}
+
 // TestLoadFail tests that the Load function in case of failure reports the
 // error details in Error.Stderr.
 func TestLoadFail(t *testing.T) {
@@ -55,3 +148,127 @@ func TestLoadFail(t *testing.T) {
 		t.Errorf("stderr does not contain pattern %q, got %q", pattern, stderr)
 	}
 }
+
+// TestLoadContextTimeout tests that the LoadContext method kills the go
+// command when the context deadline is exceeded.
+func TestLoadContextTimeout(t *testing.T) {
+	// Use a proxy that never replies, to ensure that the go command will
+	// block.
+	done := make(chan struct{})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer proxy.Close()
+	defer close(done)
+
+	modcache, err := ioutil.TempDir("", "gocmd-modcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(modcache)
+
+	l := Loader{
+		Dir: os.TempDir(),
+		Env: append(os.Environ(), "GOPROXY="+proxy.URL, "GOMODCACHE="+modcache),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	mods, err := l.LoadContext(ctx, "golang.org/x/text@v0.1.0")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if mods != nil {
+		t.Errorf("expected the data to be nil, got %v", mods)
+	}
+}
+
+// TestPrefetch tests that the Prefetch method downloads the modules in
+// parallel, reporting the progress events.
+func TestPrefetch(t *testing.T) {
+	l := Loader{
+		Dir: os.TempDir(),
+	}
+	patterns := []string{
+		"golang.org/x/text@v0.1.0",
+		"golang.org/x/text@v0.2.0",
+		"golang.org/x/text@v0.3.0",
+	}
+
+	count := make(map[EventKind]int)
+	progress := func(ev Event) {
+		count[ev.Kind]++
+		if ev.Kind == Done && ev.Bytes <= 0 {
+			t.Errorf("prefetch %v: expected bytes on disk, got %d", ev.Module, ev.Bytes)
+		}
+	}
+	mods, err := l.Prefetch(context.Background(), 2, progress, patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != len(patterns) {
+		t.Fatalf("prefetch: expected %d, got %d modules", len(patterns), len(mods))
+	}
+	for i, mod := range mods {
+		if got := mod.String(); got != patterns[i] {
+			t.Errorf("prefetch: got %q, want %q", got, patterns[i])
+		}
+	}
+	if count[Started] != 3 || count[Done] != 3 || count[Failed] != 0 {
+		t.Errorf("prefetch: got events %v", count)
+	}
+}
+
+// TestPrefetchFail tests that the Prefetch method in case of failure reports
+// the error details in Error.Stderr and the Failed events.
+func TestPrefetchFail(t *testing.T) {
+	l := Loader{
+		Dir: os.TempDir(),
+	}
+
+	var failed []Event
+	progress := func(ev Event) {
+		if ev.Kind == Failed {
+			failed = append(failed, ev)
+		}
+	}
+	mods, err := l.Prefetch(context.Background(), 2, progress, "golang.org/x/text@v0.1.0", "xxx@latest")
+	if mods != nil {
+		t.Errorf("expected the data to be nil, got %v", mods)
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an error of type *Error, got %v", err)
+	}
+	const pattern = "xxx@latest: malformed module path"
+	if stderr := string(e.Stderr); !strings.Contains(stderr, pattern) {
+		t.Errorf("stderr does not contain pattern %q, got %q", pattern, stderr)
+	}
+	if len(failed) != 1 {
+		t.Errorf("prefetch: expected 1 failed event, got %v", failed)
+	}
+}
+
+// TestShard tests the shard function.
+func TestShard(t *testing.T) {
+	tests := []struct {
+		n    int
+		p    int
+		want []int
+	}{
+		{0, 4, []int{0}},
+		{3, 4, []int{1, 1, 1}},
+		{10, 4, []int{3, 3, 3, 1}},
+		{8, 4, []int{2, 2, 2, 2}},
+	}
+	for _, test := range tests {
+		patterns := make([]string, test.n)
+		var got []int
+		for _, s := range shard(patterns, test.p) {
+			got = append(got, len(s))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("shard %d in %d: got %v, want %v", test.n, test.p, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modfetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/perillo/gocmd/internal/invoke"
+)
+
+// EventKind is the kind of a prefetch progress event.
+type EventKind int
+
+// Values for EventKind.
+const (
+	Started EventKind = iota // the download of a pattern started
+	Done                     // a module has been downloaded
+	Failed                   // a module, or a pattern, cannot be downloaded
+)
+
+// String implements the Stringer interface.
+func (k EventKind) String() string {
+	switch k {
+	case Started:
+		return "started"
+	case Done:
+		return "done"
+	case Failed:
+		return "failed"
+	}
+
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a prefetch progress event.
+type Event struct {
+	Kind EventKind
+
+	// Pattern is the pattern being downloaded, for Started events and for
+	// Failed events when the go command failed without reporting the
+	// modules.
+	Pattern string
+
+	// Module is the downloaded module, for Done and Failed events.
+	Module *Module
+
+	// Bytes is the size of the module files on disk, including the
+	// extracted source tree, for Done events.
+	Bytes int64
+
+	// Err is the error, for Failed events.
+	Err error
+}
+
+// shardsPerWorker is the number of shards assigned on average to each worker,
+// so that the workers finishing early can help with the remaining patterns.
+const shardsPerWorker = 4
+
+// Prefetch downloads the Go modules named by the given patterns, like
+// LoadContext, but shards the patterns across a pool of at most workers
+// concurrent go mod download commands.  If workers is not positive, the
+// number of CPUs is used.
+//
+// When progress is not nil, it is called for each event, in the order they
+// happen; the calls are serialized, so progress does not need to be safe for
+// concurrent use.  Since go mod download reports the modules only when it
+// completes, the Done and Failed events of a shard are reported together.
+//
+// The modules are returned in the order of the patterns, without duplicates.
+// If one or more modules cannot be loaded, Prefetch returns a nil slice and
+// the error of type *Error of the first shard that failed; the other shards
+// are still downloaded, in order to warm the module cache.
+func (l *Loader) Prefetch(ctx context.Context, workers int, progress func(Event), patterns ...string) ([]*Module, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	shards := shard(patterns, workers*shardsPerWorker)
+	attr := invoke.Attr{
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
+	}
+	version := invoke.Version(ctx, &attr, l.ResolveToolchain)
+
+	var mu sync.Mutex
+	emit := func(ev Event) {
+		if progress == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		progress(ev)
+	}
+
+	results := make([][]*Module, len(shards))
+	errs := make([]error, len(shards))
+	sem := make(chan struct{}, workers)
+	done := make(chan struct{})
+	for i := range shards {
+		go func(i int) {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+				done <- struct{}{}
+			}()
+
+			results[i], errs[i] = l.prefetch(ctx, shards[i], version, emit)
+		}(i)
+	}
+	for range shards {
+		<-done
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("modfetch: prefetch: %w", err)
+		}
+	}
+
+	var modlist []*Module
+	seen := make(map[string]bool)
+	for _, mods := range results {
+		for _, mod := range mods {
+			if key := mod.String(); !seen[key] {
+				seen[key] = true
+				modlist = append(modlist, mod)
+			}
+		}
+	}
+	if l.Check || l.ReadInfo {
+		if err := l.check(ctx, &attr, modlist); err != nil {
+			return nil, fmt.Errorf("modfetch: prefetch: %w", err)
+		}
+	}
+
+	return modlist, nil
+}
+
+// prefetch runs go mod download for a shard of patterns, decoding the modules
+// as soon as they are written by the go command.  The modules are recorded as
+// fetched by the toolchain version.
+func (l *Loader) prefetch(ctx context.Context, patterns []string, version string, emit func(Event)) ([]*Module, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	attr := invoke.Attr{
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
+	}
+	argv := []string{"download", "-json"}
+	argv = append(argv, patterns...)
+
+	for _, pattern := range patterns {
+		emit(Event{Kind: Started, Pattern: pattern})
+	}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- invoke.GoStream(ctx, "mod", argv, &attr, pw)
+		pw.Close()
+	}()
+
+	var (
+		modlist []*Module
+		msgs    []string
+	)
+	for dec := json.NewDecoder(pr); ; {
+		tmp := new(moduleJSON)
+		if err := dec.Decode(tmp); err == io.EOF {
+			break
+		} else if err != nil {
+			pr.CloseWithError(err)
+			cancel()
+			if gerr := <-done; gerr != nil {
+				return nil, gerr
+			}
+
+			return nil, fmt.Errorf("JSON decode: %w", err)
+		}
+
+		mod := fromInternal(tmp)
+		mod.Toolchain = version
+		modlist = append(modlist, mod)
+		if mod.Error != nil {
+			msgs = append(msgs, mod.Error.Err)
+			emit(Event{Kind: Failed, Module: mod, Err: mod.Error})
+
+			continue
+		}
+		emit(Event{Kind: Done, Module: mod, Bytes: size(mod)})
+	}
+	if err := <-done; err != nil {
+		// As in LoadContext, report the module errors in Stderr.
+		if e, ok := err.(*Error); ok && msgs != nil {
+			e.Stderr = []byte(strings.Join(msgs, "\n"))
+		}
+		if modlist == nil {
+			for _, pattern := range patterns {
+				emit(Event{Kind: Failed, Pattern: pattern, Err: err})
+			}
+		}
+
+		return nil, err
+	}
+
+	return modlist, nil
+}
+
+// shard splits patterns in at most n shards of similar size.  There is always
+// at least one shard, so that go mod download without patterns is supported.
+func shard(patterns []string, n int) [][]string {
+	if len(patterns) == 0 {
+		return [][]string{nil}
+	}
+	size := (len(patterns) + n - 1) / n
+
+	var shards [][]string
+	for len(patterns) > size {
+		shards = append(shards, patterns[:size:size])
+		patterns = patterns[size:]
+	}
+	shards = append(shards, patterns)
+
+	return shards
+}
+
+// size returns the size of the module files in the module cache, including
+// the extracted source tree.  Files that cannot be read are ignored.
+func size(mod *Module) int64 {
+	var n int64
+	for _, path := range []string{mod.Info, mod.GoMod, mod.Zip} {
+		if path == "" {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			n += fi.Size()
+		}
+	}
+	if mod.Dir != "" {
+		filepath.Walk(mod.Dir, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				n += fi.Size()
+			}
+
+			return nil
+		})
+	}
+
+	return n
+}
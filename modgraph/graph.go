@@ -0,0 +1,419 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modgraph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/semver"
+)
+
+// Node is a node in the module graph: a module path and version.  The main
+// modules have an empty version.
+//
+// The go mod graph output also includes the go@version and
+// toolchain@version nodes, reporting the go and toolchain directives.
+type Node struct {
+	Path    string
+	Version string
+}
+
+// ParseNode parses a node in the form path@version or path.
+func ParseNode(s string) Node {
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		return Node{Path: s[:i], Version: s[i+1:]}
+	}
+
+	return Node{Path: s}
+}
+
+// String implements the Stringer interface.
+func (n Node) String() string {
+	if n.Version == "" {
+		return n.Path
+	}
+
+	return n.Path + "@" + n.Version
+}
+
+// IsMain reports whether n is a main module.
+func (n Node) IsMain() bool {
+	return n.Version == ""
+}
+
+// isDirective reports whether n represents a go or toolchain directive.
+func (n Node) isDirective() bool {
+	return n.Path == "go" || n.Path == "toolchain"
+}
+
+// Edge is a requirement edge, from a module to a module it requires.
+type Edge struct {
+	From Node
+	To   Node
+}
+
+// Graph is a module requirement graph.
+type Graph struct {
+	nodes []Node // in order of appearance
+	edges []Edge
+	succ  map[Node][]Node
+	pred  map[Node][]Node
+}
+
+// New returns the graph with the specified edges.
+func New(edges []Edge) *Graph {
+	g := &Graph{
+		edges: edges,
+		succ:  make(map[Node][]Node),
+		pred:  make(map[Node][]Node),
+	}
+	seen := make(map[Node]bool)
+	add := func(n Node) {
+		if !seen[n] {
+			seen[n] = true
+			g.nodes = append(g.nodes, n)
+		}
+	}
+	for _, e := range edges {
+		add(e.From)
+		add(e.To)
+		g.succ[e.From] = append(g.succ[e.From], e.To)
+		g.pred[e.To] = append(g.pred[e.To], e.From)
+	}
+
+	return g
+}
+
+// Nodes returns all the nodes in the graph, in order of appearance.
+func (g *Graph) Nodes() []Node {
+	return g.nodes
+}
+
+// Edges returns all the edges in the graph.
+func (g *Graph) Edges() []Edge {
+	return g.edges
+}
+
+// Main returns the main modules.
+func (g *Graph) Main() []Node {
+	var buf []Node
+	for _, n := range g.nodes {
+		if n.IsMain() {
+			buf = append(buf, n)
+		}
+	}
+
+	return buf
+}
+
+// Requirements returns the modules directly required by n.
+func (g *Graph) Requirements(n Node) []Node {
+	return g.succ[n]
+}
+
+// RequiredBy returns the modules that directly require n.  It answers the
+// question: which requirement pulls in this version?
+func (g *Graph) RequiredBy(n Node) []Node {
+	return g.pred[n]
+}
+
+// Versions returns all the versions of the module path in the graph, sorted
+// by semantic version.
+func (g *Graph) Versions(path string) []string {
+	var buf []string
+	for _, n := range g.nodes {
+		if n.Path == path && n.Version != "" {
+			buf = append(buf, n.Version)
+		}
+	}
+	sort.Slice(buf, func(i, j int) bool {
+		return semver.Compare(buf[i], buf[j]) < 0
+	})
+
+	return buf
+}
+
+// Paths returns the requirement paths from the node from to the node to,
+// including both.  Only paths that do not visit the same node twice are
+// returned, shortest first.  If max is greater than 0, at most max paths are
+// returned.
+//
+// The paths are found with the Yen's k shortest paths algorithm, so each
+// path costs a few breadth first searches.  Since the number of paths can
+// grow exponentially with the size of the graph, max should be greater than
+// 0 for large graphs.
+func (g *Graph) Paths(from, to Node, max int) [][]Node {
+	first := g.shortest(from, to, nil, nil)
+	if first == nil {
+		return nil
+	}
+
+	paths := [][]Node{first}
+	var candidates [][]Node
+	for max <= 0 || len(paths) < max {
+		prev := paths[len(paths)-1]
+		for i := 0; i < len(prev)-1; i++ {
+			// Find the shortest path that deviates from prev at node i,
+			// without using the edges of the paths already found with the
+			// same root, and without visiting the root again.
+			spur, root := prev[i], prev[:i+1]
+			skip := make(map[Edge]bool)
+			for _, p := range paths {
+				if len(p) > i+1 && equal(p[:i+1], root) {
+					skip[Edge{p[i], p[i+1]}] = true
+				}
+			}
+			block := make(map[Node]bool)
+			for _, n := range root[:i] {
+				block[n] = true
+			}
+
+			tail := g.shortest(spur, to, block, skip)
+			if tail == nil {
+				continue
+			}
+			path := append(append([]Node(nil), root[:i]...), tail...)
+			if !contains(paths, path) && !contains(candidates, path) {
+				candidates = append(candidates, path)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		// Select the shortest candidate, preferring the first found.
+		k := 0
+		for i, p := range candidates {
+			if len(p) < len(candidates[k]) {
+				k = i
+			}
+		}
+		paths = append(paths, candidates[k])
+		candidates = append(candidates[:k], candidates[k+1:]...)
+	}
+
+	return paths
+}
+
+// PathsFromMain returns the requirement paths from the main modules to n, as
+// described in Paths.
+func (g *Graph) PathsFromMain(n Node, max int) [][]Node {
+	var buf [][]Node
+	for _, m := range g.Main() {
+		left := 0
+		if max > 0 {
+			left = max - len(buf)
+			if left <= 0 {
+				break
+			}
+		}
+		buf = append(buf, g.Paths(m, n, left)...)
+	}
+
+	return buf
+}
+
+// Selected returns the version of each module selected by minimal version
+// selection: the maximum version of each module path reachable from the main
+// modules.  The main modules and the go and toolchain directives are not
+// included.
+func (g *Graph) Selected() map[string]string {
+	selected := make(map[string]string)
+	for _, n := range g.reachable(g.Main()) {
+		if n.IsMain() || n.isDirective() {
+			continue
+		}
+		if v, ok := selected[n.Path]; !ok || semver.Compare(n.Version, v) > 0 {
+			selected[n.Path] = n.Version
+		}
+	}
+
+	return selected
+}
+
+// Prune returns the subgraph containing only the requirements of the main
+// modules and of the selected module versions, as reported by Selected.  It
+// removes the requirements of the versions that lost minimal version
+// selection, so that each remaining path explains why a selected version is
+// in the build list.
+//
+// Since minimal version selection also follows the requirements of the
+// versions that lost, a selected version can be required only by them.  In
+// this case the shortest path from the main modules to the selected version
+// is kept, including the versions that lost.  As a result, Prune and the
+// original graph report the same selected versions.
+func (g *Graph) Prune() *Graph {
+	selected := g.Selected()
+	isSelected := func(n Node) bool {
+		return selected[n.Path] == n.Version
+	}
+	keep := func(n Node) bool {
+		return n.IsMain() || n.isDirective() || isSelected(n)
+	}
+
+	kept := make(map[Edge]bool)
+	succ := make(map[Node][]Node)
+	for _, e := range g.edges {
+		if keep(e.From) && keep(e.To) {
+			kept[e] = true
+			succ[e.From] = append(succ[e.From], e.To)
+		}
+	}
+
+	// Add the paths to the selected versions that are only required by the
+	// versions that lost.
+	seen := make(map[Node]bool)
+	for _, n := range reach(g.Main(), succ) {
+		seen[n] = true
+	}
+	for _, n := range g.nodes {
+		if seen[n] || n.IsMain() || !isSelected(n) {
+			continue
+		}
+		path := g.shortestFrom(seen, n)
+		for i := 0; i < len(path)-1; i++ {
+			e := Edge{path[i], path[i+1]}
+			if !kept[e] {
+				kept[e] = true
+				succ[e.From] = append(succ[e.From], e.To)
+			}
+		}
+		for _, n := range reach(path, succ) {
+			seen[n] = true
+		}
+	}
+
+	var edges []Edge
+	for _, e := range g.edges {
+		if kept[e] {
+			edges = append(edges, e)
+		}
+	}
+
+	return New(edges)
+}
+
+// shortest returns the shortest path from the node from to the node to,
+// found with a breadth first search that does not visit the blocked nodes
+// and does not follow the skipped edges, or nil.
+func (g *Graph) shortest(from, to Node, block map[Node]bool, skip map[Edge]bool) []Node {
+	if block[from] {
+		return nil
+	}
+
+	parent := map[Node]Node{from: from}
+	queue := []Node{from}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n == to {
+			return trace(parent, n)
+		}
+		for _, next := range g.succ[n] {
+			if _, ok := parent[next]; ok || block[next] || skip[Edge{n, next}] {
+				continue
+			}
+			parent[next] = n
+			queue = append(queue, next)
+		}
+	}
+
+	return nil
+}
+
+// shortestFrom returns the shortest path from any of the nodes in roots to
+// the node to, or nil.
+func (g *Graph) shortestFrom(roots map[Node]bool, to Node) []Node {
+	parent := make(map[Node]Node)
+	var queue []Node
+	for _, n := range g.nodes {
+		if roots[n] {
+			parent[n] = n
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n == to {
+			return trace(parent, n)
+		}
+		for _, next := range g.succ[n] {
+			if _, ok := parent[next]; ok {
+				continue
+			}
+			parent[next] = n
+			queue = append(queue, next)
+		}
+	}
+
+	return nil
+}
+
+// trace returns the path to n, following the parent of each node until a
+// node that is its own parent.
+func trace(parent map[Node]Node, n Node) []Node {
+	path := []Node{n}
+	for parent[n] != n {
+		n = parent[n]
+		path = append(path, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return path
+}
+
+// equal reports whether the paths a and b are equal.
+func equal(a, b []Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contains reports whether paths contains path.
+func contains(paths [][]Node, path []Node) bool {
+	for _, p := range paths {
+		if equal(p, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reachable returns the nodes reachable from roots, including them.
+func (g *Graph) reachable(roots []Node) []Node {
+	return reach(roots, g.succ)
+}
+
+// reach returns the nodes reachable from roots following the edges in succ,
+// including them.
+func reach(roots []Node, succ map[Node][]Node) []Node {
+	seen := make(map[Node]bool)
+	var buf []Node
+	queue := append([]Node(nil), roots...)
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		buf = append(buf, n)
+		queue = append(queue, succ[n]...)
+	}
+
+	return buf
+}
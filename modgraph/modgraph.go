@@ -0,0 +1,134 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package modgraph is a wrapper for the go mod graph command.
+package modgraph
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
+)
+
+// Error is returned by Load in case the go command returns an error.
+type Error = invoke.Error
+
+// Loader is used to provide custom options for loading the module graph.
+type Loader struct {
+	// Dir is the directory in which to run the go mod graph command.
+	// If Dir is empty, go mod graph is run in the current directory.
+	Dir string
+
+	// Env is the environment to use when invoking go mod graph.
+	// If Env is nil, the current environment is used.
+	Env []string
+
+	// Runner is the runner used to run the go mod graph command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go mod graph command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+
+	// GOWORK is the go.work file to use, by setting GOWORK.  It can be set to
+	// "off" to disable workspace mode.  If empty, the value from Env is used.
+	GOWORK string
+
+	// Go is the Go version used to load the graph, as in the -go flag.
+	// Since module graph pruning was introduced in Go 1.17, setting Go to
+	// 1.16 reports the unpruned graph.  If empty, the version from the go
+	// directive in go.mod is used.
+	Go string
+}
+
+// Load loads and returns the module requirement graph of the main module.
+//
+// If the graph cannot be loaded, Load returns a nil graph and an error of
+// type *Error.
+func (l *Loader) Load() (*Graph, error) {
+	return l.LoadContext(context.Background())
+}
+
+// LoadContext is like Load but includes a context.
+//
+// If the context is done before loading completes, the go mod graph command
+// is killed and LoadContext returns a nil graph and an error of type *Error
+// that wraps ctx.Err().
+func (l *Loader) LoadContext(ctx context.Context) (*Graph, error) {
+	attr := invoke.Attr{
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
+	}
+	argv := []string{"graph"}
+	if l.Go != "" {
+		argv = append(argv, "-go="+l.Go)
+	}
+
+	stdout, err := invoke.GoContext(ctx, "mod", argv, &attr)
+	if err != nil {
+		return nil, fmt.Errorf("modgraph: load: %w", err)
+	}
+	g, err := parse(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("modgraph: load: %w", err)
+	}
+
+	return g, nil
+}
+
+// Load loads and returns the module requirement graph of the main module,
+// using the default loader configuration.
+//
+// If the graph cannot be loaded, Load returns a nil graph and an error of
+// type *Error.
+func Load() (*Graph, error) {
+	var l Loader
+
+	return l.Load()
+}
+
+// environ returns the environment corresponding to the loader options.
+func (l *Loader) environ() []string {
+	if l.GOWORK != "" {
+		return invoke.Setenv(l.Env, "GOWORK", l.GOWORK)
+	}
+
+	return l.Env
+}
+
+// parse parses the go mod graph output.  Each line contains an edge, in the
+// form "from to".
+func parse(data []byte) (*Graph, error) {
+	var edges []Edge
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: invalid edge %q", n, line)
+		}
+		e := Edge{
+			From: ParseNode(fields[0]),
+			To:   ParseNode(fields[1]),
+		}
+		edges = append(edges, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return New(edges), nil
+}
@@ -0,0 +1,287 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modgraph
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/perillo/gocmd/runner"
+)
+
+// graph is a module graph where example.com/b@v1.1.0 is required both
+// directly and by example.com/a@v1.0.0, and example.com/c@v1.0.0 is only
+// required by the version of example.com/b that lost minimal version
+// selection.
+const graph = `example.com/m example.com/a@v1.0.0
+example.com/m example.com/b@v1.0.0
+example.com/m go@1.21
+example.com/a@v1.0.0 example.com/b@v1.1.0
+example.com/b@v1.0.0 example.com/c@v1.0.0
+example.com/b@v1.1.0 example.com/d@v1.0.0
+`
+
+// fake returns a loader that returns stdout as the go mod graph output, and
+// stores the arguments in argv.
+func fake(stdout string, argv *[]string) *Loader {
+	l := &Loader{
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			*argv = inv.Argv
+			res := &runner.Result{
+				Stdout: []byte(stdout),
+			}
+
+			return res, nil
+		}),
+	}
+
+	return l
+}
+
+func node(s string) Node {
+	return ParseNode(s)
+}
+
+func nodes(s ...string) []Node {
+	buf := make([]Node, len(s))
+	for i, s := range s {
+		buf[i] = ParseNode(s)
+	}
+
+	return buf
+}
+
+// TestLoad tests the Load function on a module without dependencies.
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gomod := "module example.com/m\n\ngo 1.16\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	l := Loader{
+		Dir: dir,
+	}
+	g, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nodes("example.com/m", "go@1.16")
+	if got := g.Nodes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("nodes: got %v, want %v", got, want)
+	}
+}
+
+// TestLoadFail tests that the Load function in case of failure reports the
+// error details in Error.Stderr.
+func TestLoadFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := Loader{
+		Dir: dir,
+		Env: append(os.Environ(), "GO111MODULE=on", "GOWORK=off"),
+	}
+	g, err := l.Load()
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if g != nil {
+		t.Errorf("expected the graph to be nil, got %v", g)
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an error of type *Error, got %v", err)
+	}
+	const pattern = "go.mod file not found"
+	if stderr := string(e.Stderr); !strings.Contains(stderr, pattern) {
+		t.Errorf("stderr does not contain pattern %q, got %q", pattern, stderr)
+	}
+}
+
+// TestLoadGo tests that the Go option is passed as the -go flag.
+func TestLoadGo(t *testing.T) {
+	var argv []string
+	l := fake(graph, &argv)
+	l.Go = "1.16"
+
+	if _, err := l.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mod", "graph", "-go=1.16"}
+	if !reflect.DeepEqual(argv, want) {
+		t.Errorf("argv: got %q, want %q", argv, want)
+	}
+}
+
+// TestParseFail tests that an invalid edge is reported as an error.
+func TestParseFail(t *testing.T) {
+	var argv []string
+	l := fake("example.com/m\n", &argv)
+
+	if _, err := l.Load(); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// TestGraph tests the Graph queries.
+func TestGraph(t *testing.T) {
+	var argv []string
+	g, err := fake(graph, &argv).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := g.Main(), nodes("example.com/m"); !reflect.DeepEqual(got, want) {
+		t.Errorf("main: got %v, want %v", got, want)
+	}
+
+	b := node("example.com/b@v1.1.0")
+	if got, want := g.RequiredBy(b), nodes("example.com/a@v1.0.0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("required by: got %v, want %v", got, want)
+	}
+	if got, want := g.Requirements(b), nodes("example.com/d@v1.0.0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("requirements: got %v, want %v", got, want)
+	}
+	if got, want := g.Versions("example.com/b"), []string{"v1.0.0", "v1.1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions: got %v, want %v", got, want)
+	}
+
+	want := [][]Node{
+		nodes("example.com/m", "example.com/a@v1.0.0", "example.com/b@v1.1.0", "example.com/d@v1.0.0"),
+	}
+	if got := g.PathsFromMain(node("example.com/d@v1.0.0"), 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("paths: got %v, want %v", got, want)
+	}
+
+	selected := map[string]string{
+		"example.com/a": "v1.0.0",
+		"example.com/b": "v1.1.0",
+		"example.com/c": "v1.0.0",
+		"example.com/d": "v1.0.0",
+	}
+	if got := g.Selected(); !reflect.DeepEqual(got, selected) {
+		t.Errorf("selected: got %v, want %v", got, selected)
+	}
+}
+
+// TestPaths tests the Paths method with multiple paths and a limit.
+func TestPaths(t *testing.T) {
+	g := New([]Edge{
+		{node("m"), node("a@v1.0.0")},
+		{node("m"), node("b@v1.0.0")},
+		{node("a@v1.0.0"), node("b@v1.0.0")},
+		{node("b@v1.0.0"), node("a@v1.0.0")}, // cycle
+		{node("b@v1.0.0"), node("c@v1.0.0")},
+	})
+	c := node("c@v1.0.0")
+
+	want := [][]Node{
+		nodes("m", "b@v1.0.0", "c@v1.0.0"),
+		nodes("m", "a@v1.0.0", "b@v1.0.0", "c@v1.0.0"),
+	}
+	if got := g.Paths(node("m"), c, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("paths: got %v, want %v", got, want)
+	}
+	// The shortest path is returned first, even if a depth first search
+	// would find the longer path through example.com/a first.
+	if got := g.Paths(node("m"), c, 1); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("paths: got %v, want %v", got, want[:1])
+	}
+	if got := g.Paths(c, node("m"), 0); got != nil {
+		t.Errorf("paths: expected no paths, got %v", got)
+	}
+}
+
+// TestPathsShortest tests that the Paths method returns the paths shortest
+// first, with a limit.
+func TestPathsShortest(t *testing.T) {
+	g := New([]Edge{
+		{node("m"), node("a@v1.0.0")},
+		{node("a@v1.0.0"), node("b@v1.0.0")},
+		{node("b@v1.0.0"), node("c@v1.0.0")},
+		{node("c@v1.0.0"), node("z@v1.0.0")},
+		{node("a@v1.0.0"), node("c@v1.0.0")},
+		{node("m"), node("d@v1.0.0")},
+		{node("d@v1.0.0"), node("z@v1.0.0")},
+	})
+
+	want := [][]Node{
+		nodes("m", "d@v1.0.0", "z@v1.0.0"),
+		nodes("m", "a@v1.0.0", "c@v1.0.0", "z@v1.0.0"),
+		nodes("m", "a@v1.0.0", "b@v1.0.0", "c@v1.0.0", "z@v1.0.0"),
+	}
+	for max := 1; max <= len(want)+1; max++ {
+		n := max
+		if n > len(want) {
+			n = len(want)
+		}
+		if got := g.Paths(node("m"), node("z@v1.0.0"), max); !reflect.DeepEqual(got, want[:n]) {
+			t.Errorf("paths %d: got %v, want %v", max, got, want[:n])
+		}
+	}
+}
+
+// TestPrune tests that the Prune method removes the requirements of the
+// versions that lost minimal version selection, but keeps the only path to a
+// selected version, so that Prune and Selected agree.
+func TestPrune(t *testing.T) {
+	var argv []string
+	g, err := fake(graph, &argv).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// example.com/c@v1.0.0 is selected, but only required by
+	// example.com/b@v1.0.0.
+	p := g.Prune()
+	want := []Edge{
+		{node("example.com/m"), node("example.com/a@v1.0.0")},
+		{node("example.com/m"), node("example.com/b@v1.0.0")},
+		{node("example.com/m"), node("go@1.21")},
+		{node("example.com/a@v1.0.0"), node("example.com/b@v1.1.0")},
+		{node("example.com/b@v1.0.0"), node("example.com/c@v1.0.0")},
+		{node("example.com/b@v1.1.0"), node("example.com/d@v1.0.0")},
+	}
+	if got := p.Edges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("edges: got %v, want %v", got, want)
+	}
+	if got, want := p.Selected(), g.Selected(); !reflect.DeepEqual(got, want) {
+		t.Errorf("selected: got %v, want %v", got, want)
+	}
+	for path, version := range g.Selected() {
+		n := Node{Path: path, Version: version}
+		if paths := p.PathsFromMain(n, 1); len(paths) != 1 {
+			t.Errorf("prune: expected a path to %v", n)
+		}
+	}
+
+	// When example.com/c@v1.1.0 is also required by a selected version, the
+	// requirements of the version of example.com/b that lost are removed.
+	g = New(append(g.Edges(), Edge{node("example.com/d@v1.0.0"), node("example.com/c@v1.1.0")}))
+	want = []Edge{
+		{node("example.com/m"), node("example.com/a@v1.0.0")},
+		{node("example.com/m"), node("go@1.21")},
+		{node("example.com/a@v1.0.0"), node("example.com/b@v1.1.0")},
+		{node("example.com/b@v1.1.0"), node("example.com/d@v1.0.0")},
+		{node("example.com/d@v1.0.0"), node("example.com/c@v1.1.0")},
+	}
+	if got := g.Prune().Edges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("edges: got %v, want %v", got, want)
+	}
+}
@@ -2,52 +2,141 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// The Module.String method has been adapted from
-// src/cmd/go/internal/modinfo/info.go in the Go source distribution.
+// The Module.String and ModuleError.UnmarshalJSON methods have been adapted
+// from src/cmd/go/internal/modinfo/info.go in the Go source distribution.
 // Copyright 2018 The Go Authors. All rights reserved.
 
 package modlist
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/perillo/gocmd/env"
+	"github.com/perillo/gocmd/workspace"
 )
 
 // For the actual definition of Module, see
 // src/cmd/go/internal/modinfo/info.go.
 
 // Module represents a module.
+//
+// The Replace and Update fields are modules too, so that as an example the go
+// version used by a replacement is available in Replace.GoVersion.
 type Module struct {
-	Path      string       `json:",omitempty"` // module path
-	Version   string       `json:",omitempty"` // module version
-	Versions  []string     `json:",omitempty"` // available module versions (with -versions)
-	Replace   *Module      `json:",omitempty"` // replaced by this module
-	Time      *time.Time   `json:",omitempty"` // time version was created
-	Update    *Module      `json:",omitempty"` // available update, if any (with -u)
-	Main      bool         `json:",omitempty"` // is this the main module?
-	Indirect  bool         `json:",omitempty"` // is this module only an indirect dependency of main module?
-	Dir       string       `json:",omitempty"` // directory holding files for this module, if any
-	GoMod     string       `json:",omitempty"` // path to go.mod file for this module, if any
-	GoVersion string       `json:",omitempty"` // go version used in module
-	Error     *ModuleError `json:",omitempty"` // error loading module
+	Path       string       `json:",omitempty"` // module path
+	Version    string       `json:",omitempty"` // module version
+	Query      string       `json:",omitempty"` // version query corresponding to this version
+	Versions   []string     `json:",omitempty"` // available module versions (with -versions)
+	Replace    *Module      `json:",omitempty"` // replaced by this module
+	Time       *time.Time   `json:",omitempty"` // time version was created
+	Update     *Module      `json:",omitempty"` // available update, if any (with -u)
+	Main       bool         `json:",omitempty"` // is this the main module?
+	Indirect   bool         `json:",omitempty"` // is this module only an indirect dependency of main module?
+	Dir        string       `json:",omitempty"` // directory holding files for this module, if any
+	GoMod      string       `json:",omitempty"` // path to go.mod file for this module, if any
+	GoVersion  string       `json:",omitempty"` // go version used in module
+	Retracted  []string     `json:",omitempty"` // retraction information, if any (with -retracted or -u)
+	Deprecated string       `json:",omitempty"` // deprecation message, if any (with -u)
+	Error      *ModuleError `json:",omitempty"` // error loading module
+	Sum        string       `json:",omitempty"` // checksum for path, version (as in go.sum)
+	GoModSum   string       `json:",omitempty"` // checksum for go.mod (as in go.sum)
+	Origin     *Origin      `json:",omitempty"` // provenance of module
+	Reuse      bool         `json:",omitempty"` // reuse of old module info is safe
+	Toolchain  string       `json:",omitempty"` // version of the Go toolchain that loaded this module, if known
+
+	// Workspace is the use directive of the go.work file that adds this
+	// main module to the workspace, in workspace mode (with
+	// Loader.Workspace).
+	Workspace *workspace.Use `json:",omitempty"`
+
+	// Fetch describes how the go command fetches this module, or its
+	// replacement (with Loader.Fetch).  It is nil for the main modules and
+	// for the modules replaced by a local directory.
+	Fetch *env.Fetch `json:",omitempty"`
+}
+
+// For the actual definition of Origin, see
+// src/cmd/go/internal/modfetch/codehost/codehost.go.
+
+// Origin describes the provenance of a module version.
+type Origin struct {
+	VCS    string `json:",omitempty"` // version control system, as in "git"
+	URL    string `json:",omitempty"` // URL of repository
+	Subdir string `json:",omitempty"` // subdirectory in repository
+
+	Hash string `json:",omitempty"` // commit hash or ID
+
+	// If TagSum is not empty, the resolution of this module version depends
+	// on the set of tags with the TagPrefix prefix present in the repository.
+	TagPrefix string `json:",omitempty"`
+	TagSum    string `json:",omitempty"`
+
+	// If Ref is not empty, the resolution of this module version depends on
+	// Ref, as in "refs/tags/v1.2.3", resolving to Hash.
+	Ref string `json:",omitempty"`
+
+	// If RepoSum is not empty, the resolution of this module version depends
+	// on the entire state of the repository, summarized by RepoSum.
+	RepoSum string `json:",omitempty"`
+}
+
+// IsRetracted reports whether the module version has been retracted by the
+// module author.  The retraction information is only available when loading
+// with the Retracted or Update options.
+func (m *Module) IsRetracted() bool {
+	return len(m.Retracted) > 0
+}
+
+// IsDeprecated reports whether the module has been deprecated by the module
+// author.  The deprecation information is only available when loading with
+// the Update option.
+func (m *Module) IsDeprecated() bool {
+	return m.Deprecated != ""
+}
+
+// EffectiveModule returns the module that actually provides the source code:
+// the replacement if m is replaced, or else m itself.
+func (m *Module) EffectiveModule() *Module {
+	if m.Replace != nil {
+		return m.Replace
+	}
+
+	return m
 }
 
 // String implements the Stringer interface.
 func (m *Module) String() string {
 	s := m.Path
+	versionString := func(mm *Module) string {
+		v := mm.Version
+		if len(mm.Retracted) == 0 {
+			return v
+		}
+
+		return v + " (retracted)"
+	}
+
 	if m.Version != "" {
-		s += " " + m.Version
+		s += " " + versionString(m)
 		if m.Update != nil {
-			s += " [" + m.Update.Version + "]"
+			s += " [" + versionString(m.Update) + "]"
 		}
 	}
+	if m.Deprecated != "" {
+		s += " (deprecated)"
+	}
 	if m.Replace != nil {
 		s += " => " + m.Replace.Path
 		if m.Replace.Version != "" {
-			s += " " + m.Replace.Version
+			s += " " + versionString(m.Replace)
 			if m.Replace.Update != nil {
-				s += " [" + m.Replace.Update.Version + "]"
+				s += " [" + versionString(m.Replace.Update) + "]"
 			}
 		}
+		if m.Replace.Deprecated != "" {
+			s += " (deprecated)"
+		}
 	}
 
 	return s
@@ -58,6 +147,20 @@ type ModuleError struct {
 	Err string // the error itself
 }
 
+type moduleErrorNoMethods ModuleError
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+//
+// It accepts both {"Err":"text"} and "text", since the latter is used by
+// go mod download -json.
+func (me *ModuleError) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &me.Err)
+	}
+
+	return json.Unmarshal(data, (*moduleErrorNoMethods)(me))
+}
+
 // Error implements the error interface.
 func (me *ModuleError) Error() string {
 	return me.Err
@@ -7,15 +7,38 @@ package modlist
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"strings"
 
+	"github.com/perillo/gocmd/env"
 	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
+	"github.com/perillo/gocmd/workspace"
 )
 
 // Error is returned by Load in case the go command returns an error.
 type Error = invoke.Error
 
+// LoadError is returned by Load, when the AllowErrors option is set, in case
+// one or more modules have errors.
+type LoadError struct {
+	Modules []*Module // modules with errors
+}
+
+// Error implements the error interface.
+func (e *LoadError) Error() string {
+	buf := make([]string, 0, len(e.Modules))
+	for _, mod := range e.Modules {
+		buf = append(buf, mod.Error.Err)
+	}
+
+	return fmt.Sprintf("%d modules with errors: %s", len(e.Modules), strings.Join(buf, "; "))
+}
+
 // Loader is used to provide custom options for loading modules.
 type Loader struct {
 	// Dir is the directory in which to run the go list -m command.
@@ -25,6 +48,54 @@ type Loader struct {
 	// Env is the environment to use when invoking go list -m.
 	// If Env is nil, the current environment is used.
 	Env []string
+
+	// Runner is the runner used to run the go list -m command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go list -m command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+
+	// ResolveToolchain, when true and Toolchain is nil, causes go env
+	// GOVERSION to be run too, so that the Toolchain field of each module
+	// records the version of the go command in $PATH, or of the one selected
+	// by GOTOOLCHAIN.
+	ResolveToolchain bool
+
+	// GOWORK is the go.work file to use, by setting GOWORK.  It can be set to
+	// "off" to disable workspace mode.  If empty, the value from Env is used.
+	GOWORK string
+
+	// Workspace, when true, causes Load to set Workspace for each main
+	// module, in workspace mode.  The go.work file is read with go work edit
+	// -json; if it cannot be read, Workspace is not set and Load does not
+	// fail.
+	Workspace bool
+
+	// AllowErrors, when true, causes go list -m to be run with the -e flag,
+	// so that modules with errors are returned instead of causing Load to
+	// fail.  The errors are reported in the Error field of each module.
+	AllowErrors bool
+
+	// Update, when true, causes go list -m to be run with the -u flag, so
+	// that Update and Deprecated are set for each module.
+	Update bool
+
+	// Versions, when true, causes go list -m to be run with the -versions
+	// flag, so that Versions is set for each module.
+	Versions bool
+
+	// Retracted, when true, causes go list -m to be run with the -retracted
+	// flag, so that Retracted is set and retracted versions are included in
+	// Versions.
+	Retracted bool
+
+	// Fetch, when true, causes Load to set Fetch for each dependency, with
+	// the sources, checksum database and privacy settings used by the go
+	// command to fetch it, according to GOPRIVATE, GONOPROXY, GONOSUMDB,
+	// GOINSECURE, GOPROXY and GOSUMDB.
+	Fetch bool
 }
 
 // Load loads and returns the Go modules named by the given patterns.
@@ -33,15 +104,32 @@ type Loader struct {
 // If one or more modules cannot be loaded, Load returns a nil slice and an
 // error of type *Error.  If Load returns successfully, the returned modules
 // have all been correctly loaded.
+//
+// When AllowErrors is true, Load returns all the modules, including the ones
+// that cannot be loaded.  If one or more modules have errors, the error will
+// be of type *LoadError.  An error of type *Error is still returned if the go
+// command fails.
 func (l *Loader) Load(patterns ...string) ([]*Module, error) {
+	return l.LoadContext(context.Background(), patterns...)
+}
+
+// LoadContext is like Load but includes a context.
+//
+// If the context is done before loading completes, the go list -m command is
+// killed and LoadContext returns a nil slice and an error of type *Error that
+// wraps ctx.Err().
+func (l *Loader) LoadContext(ctx context.Context, patterns ...string) ([]*Module, error) {
 	attr := invoke.Attr{
-		Dir: l.Dir,
-		Env: l.Env,
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
 	}
-	argv := []string{"-json", "-m"} // note no -e flag for now
+	argv := []string{"-json", "-m"}
+	argv = append(argv, l.flags()...)
 	argv = append(argv, patterns...)
 
-	stdout, err := invoke.Go("list", argv, &attr)
+	stdout, err := invoke.GoContext(ctx, "list", argv, &attr)
 	if err != nil {
 		return nil, fmt.Errorf("modlist: load: %w", err)
 	}
@@ -49,6 +137,26 @@ func (l *Loader) Load(patterns ...string) ([]*Module, error) {
 	if err != nil {
 		return nil, fmt.Errorf("modlist: load: %w", err)
 	}
+	if v := invoke.Version(ctx, &attr, l.ResolveToolchain); v != "" {
+		for _, mod := range modlist {
+			mod.Toolchain = v
+		}
+	}
+	if l.Workspace {
+		l.workspace(ctx, modlist)
+	}
+	if l.Fetch {
+		if err := l.fetch(ctx, &attr, modlist); err != nil {
+			return nil, fmt.Errorf("modlist: load: %w", err)
+		}
+	}
+	if l.AllowErrors {
+		if broken := Failed(modlist); broken != nil {
+			err := &LoadError{Modules: broken}
+
+			return modlist, fmt.Errorf("modlist: load: %w", err)
+		}
+	}
 
 	return modlist, nil
 }
@@ -66,6 +174,89 @@ func Load(patterns ...string) ([]*Module, error) {
 	return l.Load(patterns...)
 }
 
+// environ returns the environment corresponding to the loader options.
+func (l *Loader) environ() []string {
+	if l.GOWORK != "" {
+		return invoke.Setenv(l.Env, "GOWORK", l.GOWORK)
+	}
+
+	return l.Env
+}
+
+// workspace sets the Workspace field of the main modules, when in workspace
+// mode.  Errors are ignored, since the annotation is optional.
+//
+// go env GOWORK is only run when the GOWORK option does not already specify
+// the go.work file.
+func (l *Loader) workspace(ctx context.Context, modlist []*Module) {
+	var main []*Module
+	for _, mod := range modlist {
+		if mod.Main {
+			main = append(main, mod)
+		}
+	}
+	if main == nil || l.GOWORK == "off" {
+		return
+	}
+
+	e := workspace.Editor{
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
+	}
+	file := l.GOWORK
+	if file == "" {
+		f, err := e.FileContext(ctx)
+		if err != nil || f == "" {
+			return
+		}
+		file = f
+	}
+	gowork, err := e.LoadContext(ctx)
+	if err != nil {
+		return
+	}
+	for _, mod := range main {
+		for i, use := range gowork.Use {
+			if use.Dir(file) == filepath.Clean(mod.Dir) {
+				mod.Workspace = &gowork.Use[i]
+
+				break
+			}
+		}
+	}
+}
+
+// flags returns the go list -m flags corresponding to the loader options.
+func (l *Loader) flags() []string {
+	var buf []string
+	add := func(set bool, flag string) {
+		if set {
+			buf = append(buf, flag)
+		}
+	}
+	add(l.AllowErrors, "-e")
+	add(l.Update, "-u")
+	add(l.Versions, "-versions")
+	add(l.Retracted, "-retracted")
+
+	return buf
+}
+
+// Failed returns the modules in modlist that have errors, in the same order.
+// It returns nil if no module has errors.
+func Failed(modlist []*Module) []*Module {
+	var buf []*Module
+	for _, mod := range modlist {
+		if mod.Error != nil {
+			buf = append(buf, mod)
+		}
+	}
+
+	return buf
+}
+
 func decode(data []byte) ([]*Module, error) {
 	modlist := make([]*Module, 0, 10)
 	buf := bytes.NewBuffer(data)
@@ -80,3 +271,32 @@ func decode(data []byte) ([]*Module, error) {
 
 	return modlist, nil
 }
+
+// fetch sets the Fetch field of the dependencies, using the Go environment
+// reported by go env.  The main modules and the modules replaced by a local
+// directory are not fetched, so they are ignored.
+func (l *Loader) fetch(ctx context.Context, attr *invoke.Attr, modlist []*Module) error {
+	stdout, err := invoke.GoContext(ctx, "env", []string{"-json"}, attr)
+	if err != nil {
+		return err
+	}
+	var vars map[string]string
+	if err := json.Unmarshal(stdout, &vars); err != nil {
+		return fmt.Errorf("JSON decode: %w", err)
+	}
+	e, err := env.NewEnvironment(vars)
+	if err != nil {
+		return err
+	}
+
+	m := env.NewMatcher(e)
+	for _, mod := range modlist {
+		eff := mod.EffectiveModule()
+		if mod.Main || eff.Version == "" {
+			continue
+		}
+		mod.Fetch = m.Fetch(eff.Path)
+	}
+
+	return nil
+}
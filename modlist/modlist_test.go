@@ -5,10 +5,17 @@
 package modlist
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/perillo/gocmd/internal/modtest"
+	"github.com/perillo/gocmd/runner"
 )
 
 // TestLoad tests that the Load function works correctly.
@@ -55,3 +62,282 @@ func TestLoadFail(t *testing.T) {
 		t.Errorf("stderr does not contain pattern %q, got %q", pattern, stderr)
 	}
 }
+
+// TestLoadAllowErrors tests that the Load function, with the AllowErrors
+// option set, returns all the modules and reports the modules with errors.
+func TestLoadAllowErrors(t *testing.T) {
+	l := Loader{
+		Dir:         os.TempDir(),
+		AllowErrors: true,
+	}
+
+	mods, err := l.Load("xxx@latest", "golang.org/x/text@v0.1.0")
+	if len(mods) != 2 {
+		t.Fatalf("load: expected 2, got %d modules", len(mods))
+	}
+	var e *LoadError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an error of type *LoadError, got %v", err)
+	}
+	if len(e.Modules) != 1 || e.Modules[0] != mods[0] {
+		t.Errorf("load: expected only %v with errors, got %v", mods[0], e.Modules)
+	}
+	if failed := Failed(mods); !reflect.DeepEqual(failed, e.Modules) {
+		t.Errorf("failed: got %v, want %v", failed, e.Modules)
+	}
+	if mods[1].Error != nil {
+		t.Errorf("load: unexpected error %v", mods[1].Error)
+	}
+}
+
+// TestLoadWorkspace tests that the Load function reports the workspace module
+// of each main module, and the GOWORK option.
+func TestLoadWorkspace(t *testing.T) {
+	files := map[string]string{
+		"go.work":  "go 1.18\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod": "module example.com/a\n\ngo 1.18\n",
+		"b/go.mod": "module example.com/b\n\ngo 1.18\n",
+	}
+	dir := modtest.NewModule(t, files)
+	defer os.RemoveAll(dir)
+
+	// -mod=mod is not allowed in workspace mode.
+	l := Loader{
+		Dir:       filepath.Join(dir, "a"),
+		Env:       append(os.Environ(), "GOFLAGS="),
+		Workspace: true,
+	}
+	mods, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 2 {
+		t.Fatalf("load: expected 2, got %d modules", len(mods))
+	}
+	for i, want := range []string{"./a", "./b"} {
+		if w := mods[i].Workspace; w == nil || w.DiskPath != want {
+			t.Errorf("load %s: got workspace %+v, want %q", mods[i].Path, w, want)
+		}
+	}
+
+	// The go.work file is not read without the Workspace option.
+	l.Workspace = false
+	mods, err = l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 2 || mods[0].Workspace != nil || mods[1].Workspace != nil {
+		t.Errorf("load: expected no workspace, got %v", mods)
+	}
+
+	l.Workspace = true
+	l.GOWORK = "off"
+	mods, err = l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 1 || mods[0].Workspace != nil {
+		t.Errorf("load: expected a single module outside the workspace, got %v", mods)
+	}
+}
+
+// TestLoadRunner tests that the Load function only runs go list -m with a
+// custom runner, and that the Workspace option does not cause Load to fail
+// when the go.work file cannot be read.
+func TestLoadRunner(t *testing.T) {
+	const stdout = `{"Path": "example.com/m", "Main": true, "Dir": "/src/m"}`
+	var calls [][]string
+	l := Loader{
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			calls = append(calls, inv.Argv)
+			res := &runner.Result{
+				Stdout: []byte(stdout + stdout),
+			}
+
+			return res, nil
+		}),
+	}
+
+	mods, err := l.Load("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"list", "-json", "-m", "all"}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("runner: got calls %q, want %q", calls, want)
+	}
+	if len(mods) != 2 {
+		t.Fatalf("load: expected 2, got %d modules", len(mods))
+	}
+
+	calls = nil
+	l.Workspace = true
+	mods, err = l.Load("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 || mods[0].Workspace != nil {
+		t.Errorf("load: got calls %q and workspace %v", calls, mods[0].Workspace)
+	}
+}
+
+// TestReport tests the Report method.
+func TestReport(t *testing.T) {
+	const gomod = `module example.com/m
+
+go 1.16
+
+require (
+	github.com/BurntSushi/toml v0.3.1
+	golang.org/x/text v0.3.0
+	gopkg.in/yaml.v2 v2.2.1
+	rsc.io/sampler v1.3.0
+)
+
+replace rsc.io/sampler => ./local
+`
+	files := map[string]string{
+		"go.mod":       gomod,
+		"local/go.mod": "module rsc.io/sampler\n",
+	}
+	dir := modtest.NewModule(t, files)
+	defer os.RemoveAll(dir)
+
+	l := Loader{
+		Dir: dir,
+	}
+	patterns := []string{"github.com/BurntSushi/toml", "golang.org/x/text", "gopkg.in/yaml.v2", "rsc.io/sampler"}
+	r, err := l.Report(context.Background(), patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Dependencies) != 3 {
+		t.Fatalf("report: expected 3, got %d dependencies", len(r.Dependencies))
+	}
+
+	toml, text, yaml := r.Dependencies[0], r.Dependencies[1], r.Dependencies[2]
+	// The v1 update shares the module path of v0.
+	if toml.Status != MajorBehind || toml.Major != "" {
+		t.Fatalf("report %s: got %v, major %q, want %v", toml.Module.Path, toml.Status, toml.Major, MajorBehind)
+	}
+	want := "github.com/BurntSushi/toml@v0.3.1: major behind (" + toml.Module.Update.Version + ")"
+	if got := toml.String(); got != want {
+		t.Errorf("report %s: got %q, want %q", toml.Module.Path, got, want)
+	}
+	if text.Status != MinorBehind {
+		t.Errorf("report %s: got %v, want %v", text.Module.Path, text.Status, MinorBehind)
+	}
+	// gopkg.in/yaml.v3 is the next major version.
+	if yaml.Status != MajorBehind {
+		t.Errorf("report %s: got %v, want %v", yaml.Module.Path, yaml.Status, MajorBehind)
+	}
+	if !strings.HasPrefix(yaml.Major, "gopkg.in/yaml.v3@") {
+		t.Errorf("report %s: got major %q", yaml.Module.Path, yaml.Major)
+	}
+}
+
+// TestNextMajor tests the nextMajor function.
+func TestNextMajor(t *testing.T) {
+	var tests = []struct {
+		path, version string
+		want          string
+	}{
+		{"example.com/m", "v0.1.0", "example.com/m/v2"},
+		{"example.com/m", "v1.1.0", "example.com/m/v2"},
+		{"example.com/m/v2", "v2.1.0", "example.com/m/v3"},
+		{"example.com/m", "v2.1.0+incompatible", ""},
+		{"gopkg.in/yaml.v2", "v2.2.1", "gopkg.in/yaml.v3"},
+		{"gopkg.in/check.v1", "v0.0.0-20161208181325-20d25e280405", "gopkg.in/check.v2"},
+	}
+
+	for _, test := range tests {
+		if got := nextMajor(test.path, test.version); got != test.want {
+			t.Errorf("nextMajor(%q, %q): got %q, want %q", test.path, test.version, got, test.want)
+		}
+	}
+}
+
+// TestDecode tests that the decode function handles all the go list -m
+// fields.
+func TestDecode(t *testing.T) {
+	const data = `{
+	"Path": "example.com/a",
+	"Version": "v1.0.0",
+	"Retracted": ["security issue"],
+	"Deprecated": "use example.com/b",
+	"Origin": {"VCS": "git", "URL": "https://example.com/a", "Hash": "abcdef", "Ref": "refs/tags/v1.0.0"},
+	"Replace": {"Path": "../a", "GoVersion": "1.21"}
+}
+{"Path": "example.com/b", "Error": "not found"}`
+
+	mods, err := decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := mods[0], mods[1]
+
+	if !a.IsRetracted() || !a.IsDeprecated() {
+		t.Errorf("decode %s: expected retracted and deprecated", a.Path)
+	}
+	if a.Origin == nil || a.Origin.Hash != "abcdef" || a.Origin.Ref != "refs/tags/v1.0.0" {
+		t.Errorf("decode %s: got origin %+v", a.Path, a.Origin)
+	}
+	if got := a.EffectiveModule(); got != a.Replace || got.GoVersion != "1.21" {
+		t.Errorf("decode %s: got effective module %+v", a.Path, got)
+	}
+	const want = "example.com/a v1.0.0 (retracted) (deprecated) => ../a"
+	if got := a.String(); got != want {
+		t.Errorf("string: got %q, want %q", got, want)
+	}
+
+	if b.EffectiveModule() != b {
+		t.Errorf("decode %s: expected the module itself as effective module", b.Path)
+	}
+	if b.Error == nil || b.Error.Err != "not found" {
+		t.Errorf("decode %s: got error %v", b.Path, b.Error)
+	}
+}
+
+// TestLoadFetch tests that the Load function, with the Fetch option set,
+// reports how each dependency is fetched.
+func TestLoadFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const gomod = `module example.com/m
+
+go 1.16
+
+require (
+	golang.org/x/text v0.3.0
+	gopkg.in/yaml.v2 v2.2.1
+)
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	l := Loader{
+		Dir:   dir,
+		Env:   append(os.Environ(), "GOPRIVATE=golang.org/x", "GOPROXY=https://proxy.golang.org"),
+		Fetch: true,
+	}
+	mods, err := l.Load("example.com/m", "golang.org/x/text", "gopkg.in/yaml.v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 3 {
+		t.Fatalf("load: expected 3, got %d modules", len(mods))
+	}
+	if mods[0].Fetch != nil {
+		t.Errorf("load %s: expected no fetch for the main module", mods[0].Path)
+	}
+	text, yaml := mods[1].Fetch, mods[2].Fetch
+	if text == nil || !text.Private || !text.Direct() || text.SumDB {
+		t.Errorf("load %s: got fetch %+v", mods[1].Path, text)
+	}
+	if yaml == nil || yaml.Private || yaml.Direct() || !yaml.Proxied() || !yaml.SumDB {
+		t.Errorf("load %s: got fetch %+v", mods[2].Path, yaml)
+	}
+}
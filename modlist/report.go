@@ -0,0 +1,213 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modlist
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/semver"
+)
+
+// Status is the update status of a module.
+type Status int
+
+// Values for Status, in increasing order of severity.
+const (
+	UpToDate    Status = iota // no update available
+	PatchBehind               // a patch update is available
+	MinorBehind               // a minor update is available
+	MajorBehind               // a new major version is available
+	Deprecated                // the module is deprecated
+	Retracted                 // the module version is retracted
+)
+
+var statusNames = []string{
+	UpToDate:    "up to date",
+	PatchBehind: "patch behind",
+	MinorBehind: "minor behind",
+	MajorBehind: "major behind",
+	Deprecated:  "deprecated",
+	Retracted:   "retracted",
+}
+
+// String implements the Stringer interface.
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return "Status(" + strconv.Itoa(int(s)) + ")"
+	}
+
+	return statusNames[s]
+}
+
+// Dependency reports the update status of a dependency.
+type Dependency struct {
+	Module *Module // the dependency, as loaded with the -u and -retracted flags
+	Status Status  // the most severe status of the dependency
+
+	// Major is the latest version of the next major version of the module,
+	// as in example.com/m/v2@v2.1.0, if any.
+	Major string
+}
+
+// String implements the Stringer interface.
+func (d *Dependency) String() string {
+	s := d.Module.Path + "@" + d.Module.Version + ": " + d.Status.String()
+	switch d.Status {
+	case PatchBehind, MinorBehind:
+		s += " (" + d.Module.Update.Version + ")"
+	case MajorBehind:
+		if d.Major != "" {
+			s += " (" + d.Major + ")"
+		} else if d.Module.Update != nil {
+			// As an example from v0 to v1.
+			s += " (" + d.Module.Update.Version + ")"
+		}
+	}
+
+	return s
+}
+
+// Report is the update report of a set of dependencies.
+type Report struct {
+	Dependencies []*Dependency
+}
+
+// Select returns the dependencies with the specified status.
+func (r *Report) Select(status Status) []*Dependency {
+	var buf []*Dependency
+	for _, dep := range r.Dependencies {
+		if dep.Status == status {
+			buf = append(buf, dep)
+		}
+	}
+
+	return buf
+}
+
+// Report loads the modules named by the given patterns, with the Update and
+// Retracted options set, and returns their update report.  If no patterns are
+// given, all the dependencies of the main module are reported.
+//
+// The main modules, and the modules replaced by a directory, are not
+// reported.
+//
+// Since go list -m -u only reports updates within the same major version,
+// Report also queries the latest version of the next major version of each
+// module, as in example.com/m/v2 for example.com/m.
+func (l *Loader) Report(ctx context.Context, patterns ...string) (*Report, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"all"}
+	}
+	lu := *l
+	lu.Update = true
+	lu.Retracted = true
+
+	mods, err := lu.LoadContext(ctx, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []*Dependency
+	var queries []string
+	for _, mod := range mods {
+		if mod.Main || mod.Version == "" {
+			continue
+		}
+		if mod.Replace != nil && mod.Replace.Version == "" {
+			// Replaced by a directory.
+			continue
+		}
+		dep := &Dependency{
+			Module: mod,
+			Status: status(mod),
+		}
+		deps = append(deps, dep)
+		if next := nextMajor(mod.Path, mod.Version); next != "" {
+			queries = append(queries, next+"@latest")
+		}
+	}
+
+	// Query the next major versions.  Errors are expected, since most
+	// modules do not have a next major version.
+	if len(queries) > 0 {
+		lm := *l
+		lm.AllowErrors = true
+		majors, err := lm.LoadContext(ctx, queries...)
+		if err != nil && majors == nil {
+			return nil, err
+		}
+		latest := make(map[string]string, len(majors))
+		for _, mod := range majors {
+			if mod.Error == nil && mod.Version != "" {
+				latest[mod.Path] = mod.Path + "@" + mod.Version
+			}
+		}
+		for _, dep := range deps {
+			next := nextMajor(dep.Module.Path, dep.Module.Version)
+			if v, ok := latest[next]; ok {
+				dep.Major = v
+				if dep.Status < MajorBehind {
+					dep.Status = MajorBehind
+				}
+			}
+		}
+	}
+
+	return &Report{Dependencies: deps}, nil
+}
+
+// status returns the status of mod, without considering major versions.
+func status(mod *Module) Status {
+	switch {
+	case len(mod.Retracted) > 0:
+		return Retracted
+	case mod.Deprecated != "":
+		return Deprecated
+	case mod.Update == nil:
+		return UpToDate
+	case semver.Major(mod.Update.Version) != semver.Major(mod.Version):
+		// As an example from v0 to v1, that share the same module path.
+		return MajorBehind
+	case semver.MajorMinor(mod.Update.Version) != semver.MajorMinor(mod.Version):
+		return MinorBehind
+	default:
+		return PatchBehind
+	}
+}
+
+// nextMajor returns the module path of the next major version of the module
+// path@version, or an empty string if it can not be determined.
+func nextMajor(path, version string) string {
+	if semver.Build(version) == "+incompatible" {
+		return ""
+	}
+
+	// gopkg.in paths use a .vN suffix.
+	if strings.HasPrefix(path, "gopkg.in/") {
+		i := strings.LastIndex(path, ".v")
+		if i < 0 {
+			return ""
+		}
+		n, err := strconv.Atoi(path[i+2:])
+		if err != nil {
+			return ""
+		}
+
+		return path[:i] + ".v" + strconv.Itoa(n+1)
+	}
+
+	// v0 and v1 share the same module path, without a /vN suffix.
+	n := 1
+	if i := strings.LastIndex(path, "/v"); i >= 0 {
+		if m, err := strconv.Atoi(path[i+2:]); err == nil && m >= 2 {
+			n = m
+			path = path[:i]
+		}
+	}
+
+	return path + "/v" + strconv.Itoa(n+1)
+}
@@ -0,0 +1,254 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package modwhy is a wrapper for the go mod why command.
+package modwhy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
+)
+
+// Error is returned by Load in case the go command returns an error.
+type Error = invoke.Error
+
+// Explanation explains why a package or module is needed by the main module.
+type Explanation struct {
+	// Target is the package or module path, as reported by go mod why.
+	Target string
+
+	// Chain is the shortest import chain from a package in the main module
+	// to Target, including both.  When Target is a module, the last element
+	// is the package in the module that is imported.  A test of package p is
+	// reported as p.test.
+	//
+	// Chain is nil when the target is not needed.
+	Chain []string
+
+	// NotNeeded is set when the main module does not need the target.
+	NotNeeded *NotNeeded
+}
+
+// Needed reports whether the target is needed by the main module.
+func (e *Explanation) Needed() bool {
+	return e.NotNeeded == nil
+}
+
+// NotNeeded reports that the main module does not need a package or module.
+type NotNeeded struct {
+	// Path is the package or module path.
+	Path string
+
+	// Module is true when Path is a module path.
+	Module bool
+
+	// Vendor is true when the target was explained with the Vendor option.
+	Vendor bool
+}
+
+// String returns the message reported by go mod why.
+func (n *NotNeeded) String() string {
+	var buf strings.Builder
+	buf.WriteString("main module does not need ")
+	if n.Vendor {
+		buf.WriteString("to vendor ")
+	}
+	if n.Module {
+		buf.WriteString("module ")
+	} else {
+		buf.WriteString("package ")
+	}
+	buf.WriteString(n.Path)
+
+	return buf.String()
+}
+
+// Loader is used to provide custom options for explaining packages and
+// modules.
+type Loader struct {
+	// Dir is the directory in which to run the go mod why command.
+	// If Dir is empty, go mod why is run in the current directory.
+	Dir string
+
+	// Env is the environment to use when invoking go mod why.
+	// If Env is nil, the current environment is used.
+	Env []string
+
+	// Runner is the runner used to run the go mod why command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go mod why command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+
+	// GOWORK is the go.work file to use, by setting GOWORK.  It can be set to
+	// "off" to disable workspace mode.  If empty, the value from Env is used.
+	GOWORK string
+
+	// Vendor causes go mod why to ignore the imports in tests of packages
+	// outside the main module, as in the -vendor flag.
+	Vendor bool
+}
+
+// Load explains why the specified packages are needed by the main module.
+// The packages are specified using patterns, as in go mod why, and there is
+// one explanation for each matched package.
+//
+// If the explanations cannot be loaded, Load returns nil and an error of type
+// *Error.
+func (l *Loader) Load(patterns ...string) ([]*Explanation, error) {
+	return l.LoadContext(context.Background(), patterns...)
+}
+
+// LoadContext is like Load but includes a context.
+func (l *Loader) LoadContext(ctx context.Context, patterns ...string) ([]*Explanation, error) {
+	return l.load(ctx, false, patterns)
+}
+
+// LoadModules explains why the specified modules are needed by the main
+// module, as in go mod why -m.  The modules are specified using module paths
+// or patterns, but not version queries.
+//
+// If the explanations cannot be loaded, LoadModules returns nil and an error
+// of type *Error.
+func (l *Loader) LoadModules(patterns ...string) ([]*Explanation, error) {
+	return l.LoadModulesContext(context.Background(), patterns...)
+}
+
+// LoadModulesContext is like LoadModules but includes a context.
+func (l *Loader) LoadModulesContext(ctx context.Context, patterns ...string) ([]*Explanation, error) {
+	return l.load(ctx, true, patterns)
+}
+
+func (l *Loader) load(ctx context.Context, module bool, patterns []string) ([]*Explanation, error) {
+	attr := invoke.Attr{
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
+	}
+	argv := []string{"why"}
+	if module {
+		argv = append(argv, "-m")
+	}
+	if l.Vendor {
+		argv = append(argv, "-vendor")
+	}
+	argv = append(argv, patterns...)
+
+	stdout, err := invoke.GoContext(ctx, "mod", argv, &attr)
+	if err != nil {
+		return nil, fmt.Errorf("modwhy: load: %w", err)
+	}
+	list, err := parse(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("modwhy: load: %w", err)
+	}
+
+	return list, nil
+}
+
+// Load explains why the specified packages are needed by the main module,
+// using the default loader configuration.
+//
+// If the explanations cannot be loaded, Load returns nil and an error of type
+// *Error.
+func Load(patterns ...string) ([]*Explanation, error) {
+	var l Loader
+
+	return l.Load(patterns...)
+}
+
+// LoadModules explains why the specified modules are needed by the main
+// module, using the default loader configuration.
+//
+// If the explanations cannot be loaded, LoadModules returns nil and an error
+// of type *Error.
+func LoadModules(patterns ...string) ([]*Explanation, error) {
+	var l Loader
+
+	return l.LoadModules(patterns...)
+}
+
+// environ returns the environment corresponding to the loader options.
+func (l *Loader) environ() []string {
+	if l.GOWORK != "" {
+		return invoke.Setenv(l.Env, "GOWORK", l.GOWORK)
+	}
+
+	return l.Env
+}
+
+// parse parses the go mod why output.  Each explanation starts with a
+// "# target" line, followed by either the import chain or a parenthesized
+// "not needed" message, and is separated by a blank line.
+func parse(data []byte) ([]*Explanation, error) {
+	var (
+		list []*Explanation
+		cur  *Explanation
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+			cur = nil
+		case strings.HasPrefix(line, "# "):
+			cur = &Explanation{
+				Target: line[2:],
+			}
+			list = append(list, cur)
+		case cur == nil:
+			return nil, fmt.Errorf("line %d: missing target", n)
+		case strings.HasPrefix(line, "("):
+			nn, err := parseNotNeeded(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			cur.NotNeeded = nn
+		default:
+			cur.Chain = append(cur.Chain, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// parseNotNeeded parses a "(main module does not need ...)" message.
+func parseNotNeeded(line string) (*NotNeeded, error) {
+	const prefix = "(main module does not need "
+
+	if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, ")") {
+		return nil, fmt.Errorf("invalid message %q", line)
+	}
+	s := line[len(prefix) : len(line)-1]
+
+	nn := new(NotNeeded)
+	if strings.HasPrefix(s, "to vendor ") {
+		nn.Vendor = true
+		s = s[len("to vendor "):]
+	}
+	switch {
+	case strings.HasPrefix(s, "module "):
+		nn.Module = true
+		nn.Path = s[len("module "):]
+	case strings.HasPrefix(s, "package "):
+		nn.Path = s[len("package "):]
+	default:
+		return nil, fmt.Errorf("invalid message %q", line)
+	}
+
+	return nn, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package modwhy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/perillo/gocmd/internal/modtest"
+	"github.com/perillo/gocmd/runner"
+)
+
+// TestLoad tests the Load and LoadModules functions.
+func TestLoad(t *testing.T) {
+	dir := modtest.NewModule(t, map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.16\n",
+		"main.go": "package main\n\nimport _ \"example.com/m/a\"\n\nfunc main() {}\n",
+		"a/a.go":  "package a\n\nimport _ \"strings\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := Loader{
+		Dir: dir,
+	}
+	list, err := l.Load("strings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Explanation{
+		{
+			Target: "strings",
+			Chain:  []string{"example.com/m/a", "strings"},
+		},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("load: got %+v, want %+v", list, want)
+	}
+
+	list, err = l.LoadModules("example.com/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []*Explanation{
+		{
+			Target: "example.com/m",
+			Chain:  []string{"example.com/m"},
+		},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("load modules: got %+v, want %+v", list, want)
+	}
+}
+
+// TestLoadFail tests that the LoadModules function in case of failure
+// reports the error details in Error.Stderr.
+func TestLoadFail(t *testing.T) {
+	l := Loader{
+		Dir: os.TempDir(),
+	}
+
+	list, err := l.LoadModules("golang.org/x/text@v0.1.0")
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if list != nil {
+		t.Errorf("expected the data to be nil, got %v", list)
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an error of type *Error, got %v", err)
+	}
+}
+
+// TestNotNeeded tests that the not needed messages are parsed correctly.
+func TestNotNeeded(t *testing.T) {
+	const stdout = `# golang.org/x/text
+(main module does not need module golang.org/x/text)
+
+# golang.org/x/text/language
+(main module does not need to vendor package golang.org/x/text/language)
+
+# example.com/m
+example.com/m
+`
+	var argv []string
+	l := Loader{
+		Vendor: true,
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			argv = inv.Argv
+			res := &runner.Result{
+				Stdout: []byte(stdout),
+			}
+
+			return res, nil
+		}),
+	}
+
+	list, err := l.LoadModules("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"mod", "why", "-m", "-vendor", "all"}; !reflect.DeepEqual(argv, want) {
+		t.Errorf("argv: got %q, want %q", argv, want)
+	}
+	want := []*Explanation{
+		{
+			Target: "golang.org/x/text",
+			NotNeeded: &NotNeeded{
+				Path:   "golang.org/x/text",
+				Module: true,
+			},
+		},
+		{
+			Target: "golang.org/x/text/language",
+			NotNeeded: &NotNeeded{
+				Path:   "golang.org/x/text/language",
+				Vendor: true,
+			},
+		},
+		{
+			Target: "example.com/m",
+			Chain:  []string{"example.com/m"},
+		},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("load: got %+v, want %+v", list, want)
+	}
+	if list[0].Needed() || !list[2].Needed() {
+		t.Errorf("needed: got %v and %v", list[0].Needed(), list[2].Needed())
+	}
+	for i, line := range strings.Split(stdout, "\n\n")[:2] {
+		msg := "(" + list[i].NotNeeded.String() + ")"
+		if !strings.HasSuffix(strings.TrimSpace(line), msg) {
+			t.Errorf("string: got %q, want suffix of %q", msg, line)
+		}
+	}
+}
+
+// TestParseFail tests that an invalid go mod why output is reported as an
+// error.
+func TestParseFail(t *testing.T) {
+	tests := []string{
+		"example.com/m\n",
+		"# example.com/m\n(unknown)\n",
+	}
+	for _, test := range tests {
+		if _, err := parse([]byte(test)); err == nil {
+			t.Errorf("parse %q: expected an error", test)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkglist
+
+import (
+	"sort"
+	"strings"
+)
+
+// Graph is the import graph of a set of packages, as returned by Load with the
+// Deps option set.
+//
+// The edges are resolved using Package.ImportMap, so that test variants and
+// vendored packages are handled correctly.  Imports of packages not in the
+// graph are ignored.
+type Graph struct {
+	pkgs      []*Package
+	index     map[string]*Package // import path -> package
+	imports   map[string][]string // import path -> imported packages
+	importers map[string][]string // import path -> importing packages
+}
+
+// NewGraph returns the import graph of pkgs.
+func NewGraph(pkgs []*Package) *Graph {
+	g := &Graph{
+		pkgs:      pkgs,
+		index:     make(map[string]*Package, len(pkgs)),
+		imports:   make(map[string][]string, len(pkgs)),
+		importers: make(map[string][]string, len(pkgs)),
+	}
+	for _, pkg := range pkgs {
+		g.index[pkg.ImportPath] = pkg
+	}
+	for _, pkg := range pkgs {
+		for _, path := range pkg.Imports {
+			if mapped, ok := pkg.ImportMap[path]; ok {
+				path = mapped
+			}
+			if _, ok := g.index[path]; !ok {
+				continue
+			}
+			g.imports[pkg.ImportPath] = append(g.imports[pkg.ImportPath], path)
+			g.importers[path] = append(g.importers[path], pkg.ImportPath)
+		}
+	}
+
+	return g
+}
+
+// Package returns the package with the specified import path, or nil.
+func (g *Graph) Package(path string) *Package {
+	return g.index[path]
+}
+
+// Packages returns all the packages in the graph.
+func (g *Graph) Packages() []*Package {
+	return g.pkgs
+}
+
+// Imports returns the packages directly imported by the named package,
+// sorted by import path.
+func (g *Graph) Imports(path string) []*Package {
+	return g.list(g.imports[path])
+}
+
+// Importers returns the packages that directly import the named package,
+// sorted by import path.
+func (g *Graph) Importers(path string) []*Package {
+	return g.list(g.importers[path])
+}
+
+// ReverseDeps returns the packages that directly or indirectly import one of
+// the named packages, sorted by import path.  The named packages are not
+// included, unless they import each other.
+func (g *Graph) ReverseDeps(paths ...string) []*Package {
+	seen := make(map[string]bool)
+	queue := append([]string(nil), paths...)
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		for _, importer := range g.importers[path] {
+			if !seen[importer] {
+				seen[importer] = true
+				queue = append(queue, importer)
+			}
+		}
+	}
+
+	return g.list(keys(seen))
+}
+
+// Affected returns the packages that must be rebuilt, or retested, if one of
+// the named files changes: the packages containing the files and their
+// reverse dependencies, sorted by import path.  The file names must be
+// absolute paths.
+func (g *Graph) Affected(files ...string) []*Package {
+	changed := make(map[string]bool, len(files))
+	for _, name := range files {
+		changed[name] = true
+	}
+
+	var paths []string
+	for _, pkg := range g.pkgs {
+		for _, name := range sources(pkg) {
+			if changed[name] {
+				paths = append(paths, pkg.ImportPath)
+
+				break
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		seen[path] = true
+	}
+	for _, pkg := range g.ReverseDeps(paths...) {
+		seen[pkg.ImportPath] = true
+	}
+
+	return g.list(keys(seen))
+}
+
+// ShortestPath returns the shortest import path from the package from to the
+// package to, including both, or nil if from does not depend on to.
+func (g *Graph) ShortestPath(from, to string) []string {
+	if _, ok := g.index[from]; !ok {
+		return nil
+	}
+
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if path == to {
+			var buf []string
+			for ; path != ""; path = prev[path] {
+				buf = append(buf, path)
+			}
+			reverse(buf)
+
+			return buf
+		}
+		for _, imp := range g.imports[path] {
+			if _, ok := prev[imp]; !ok {
+				prev[imp] = path
+				queue = append(queue, imp)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Sort returns the packages in topological order, so that each package
+// appears after all the packages it imports.
+//
+// If the graph contains an import cycle, Sort returns a nil slice and an error
+// of type *CycleError.
+func (g *Graph) Sort() ([]*Package, error) {
+	if cycles := g.Cycles(); len(cycles) > 0 {
+		return nil, &CycleError{Packages: cycles[0]}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g.pkgs))
+	buf := make([]*Package, 0, len(g.pkgs))
+
+	var visit func(path string)
+	visit = func(path string) {
+		if state[path] != unvisited {
+			return
+		}
+		state[path] = visiting
+		for _, imp := range g.imports[path] {
+			visit(imp)
+		}
+		state[path] = visited
+		buf = append(buf, g.index[path])
+	}
+	for _, pkg := range g.pkgs {
+		visit(pkg.ImportPath)
+	}
+
+	return buf, nil
+}
+
+// Cycles returns the strongly connected components of the graph that
+// represent import cycles: the ones with more than one package, or with a
+// package importing itself.  The packages in each component are sorted by
+// import path.
+//
+// Import cycles are reported by go list as package errors, except for the
+// ones involving test variants.
+func (g *Graph) Cycles() [][]*Package {
+	// Tarjan's strongly connected components algorithm.
+	var (
+		next    int
+		index   = make(map[string]int, len(g.pkgs))
+		lowlink = make(map[string]int, len(g.pkgs))
+		onstack = make(map[string]bool)
+		stack   []string
+		cycles  [][]*Package
+	)
+
+	var connect func(path string)
+	connect = func(path string) {
+		index[path] = next
+		lowlink[path] = next
+		next++
+		stack = append(stack, path)
+		onstack[path] = true
+
+		selfloop := false
+		for _, imp := range g.imports[path] {
+			if imp == path {
+				selfloop = true
+			}
+			if _, ok := index[imp]; !ok {
+				connect(imp)
+				lowlink[path] = min(lowlink[path], lowlink[imp])
+			} else if onstack[imp] {
+				lowlink[path] = min(lowlink[path], index[imp])
+			}
+		}
+		if lowlink[path] != index[path] {
+			return
+		}
+
+		var scc []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onstack[top] = false
+			scc = append(scc, top)
+			if top == path {
+				break
+			}
+		}
+		if len(scc) > 1 || selfloop {
+			cycles = append(cycles, g.list(scc))
+		}
+	}
+	for _, pkg := range g.pkgs {
+		if _, ok := index[pkg.ImportPath]; !ok {
+			connect(pkg.ImportPath)
+		}
+	}
+
+	return cycles
+}
+
+// list returns the packages with the specified import paths, sorted by import
+// path.
+func (g *Graph) list(paths []string) []*Package {
+	if len(paths) == 0 {
+		return nil
+	}
+	paths = append([]string(nil), paths...)
+	sort.Strings(paths)
+
+	buf := make([]*Package, 0, len(paths))
+	for _, path := range paths {
+		buf = append(buf, g.index[path])
+	}
+
+	return buf
+}
+
+// CycleError is returned by Graph.Sort in case the graph contains an import
+// cycle.
+type CycleError struct {
+	Packages []*Package // packages in the cycle
+}
+
+// Error implements the error interface.
+func (e *CycleError) Error() string {
+	buf := make([]string, 0, len(e.Packages))
+	for _, pkg := range e.Packages {
+		buf = append(buf, pkg.ImportPath)
+	}
+
+	return "pkglist: import cycle: " + strings.Join(buf, ", ")
+}
+
+func keys(m map[string]bool) []string {
+	buf := make([]string, 0, len(m))
+	for k := range m {
+		buf = append(buf, k)
+	}
+
+	return buf
+}
+
+func reverse(s []string) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
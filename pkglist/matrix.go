@@ -0,0 +1,216 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkglist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/perillo/gocmd/internal/invoke"
+)
+
+// Platform represents a build configuration.
+type Platform struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string // additional build tags
+}
+
+// String implements the Stringer interface.
+func (p Platform) String() string {
+	s := p.GOOS + "/" + p.GOARCH
+	if len(p.Tags) > 0 {
+		s += " (" + strings.Join(p.Tags, ",") + ")"
+	}
+
+	return s
+}
+
+// Matrix is the result of loading the same packages for multiple platforms.
+type Matrix struct {
+	Platforms []Platform       // the loaded platforms
+	Packages  []*MatrixPackage // sorted by import path
+}
+
+// MatrixPackage describes which platforms include a package and its files.
+type MatrixPackage struct {
+	ImportPath string
+
+	// Packages holds the package loaded for each platform, in the same order
+	// as Matrix.Platforms.  An entry is nil if the package was not loaded for
+	// the platform.
+	Packages []*Package
+
+	// Platforms holds the platforms that include the package, that is the
+	// ones where the package has at least one source file.
+	Platforms []Platform
+
+	// Files maps the absolute path of each source file of the package to the
+	// platforms that include it.  Files ignored by every platform, due to
+	// build constraints, are mapped to nil.
+	Files map[string][]Platform
+}
+
+// Platforms returns the platforms supported by the go command, as reported by
+// go tool dist list.
+func (l *Loader) Platforms(ctx context.Context) ([]Platform, error) {
+	attr := l.attr()
+	argv := []string{"dist", "list"}
+
+	stdout, err := invoke.GoContext(ctx, "tool", argv, &attr)
+	if err != nil {
+		return nil, fmt.Errorf("pkglist: platforms: %w", err)
+	}
+
+	var buf []Platform
+	sc := bufio.NewScanner(bytes.NewReader(stdout))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		i := strings.IndexByte(line, '/')
+		if i < 0 {
+			continue
+		}
+		p := Platform{
+			GOOS:   line[:i],
+			GOARCH: line[i+1:],
+		}
+		buf = append(buf, p)
+	}
+
+	return buf, nil
+}
+
+// LoadMatrix loads the Go packages named by the given patterns for each of
+// the specified platforms, and merges the results.  If platforms is nil, the
+// platforms returned by Platforms are used.
+//
+// The Tags of each platform are added to the loader Tags.  The packages are
+// always loaded with the AllowErrors option set, since a package may be
+// excluded by build constraints on some platforms; the package errors are
+// available in MatrixPackage.Packages.
+//
+// If the go command fails for one of the platforms, LoadMatrix returns a nil
+// Matrix and an error wrapping an error of type *Error.
+func (l *Loader) LoadMatrix(ctx context.Context, platforms []Platform, patterns ...string) (*Matrix, error) {
+	if platforms == nil {
+		var err error
+		if platforms, err = l.Platforms(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Load each platform concurrently, but limit the number of concurrent go
+	// commands.
+	results := make([][]*Package, len(platforms))
+	errs := make([]error, len(platforms))
+	sem := make(chan struct{}, runtime.NumCPU())
+	done := make(chan struct{})
+	for i := range platforms {
+		go func(i int) {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+				done <- struct{}{}
+			}()
+
+			results[i], errs[i] = l.loadPlatform(ctx, platforms[i], patterns)
+		}(i)
+	}
+	for range platforms {
+		<-done
+	}
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("pkglist: load matrix %v: %w", platforms[i], errors.Unwrap(err))
+		}
+	}
+
+	return merge(platforms, results), nil
+}
+
+// loadPlatform loads the packages named by patterns for platform p.
+func (l *Loader) loadPlatform(ctx context.Context, p Platform, patterns []string) ([]*Package, error) {
+	lp := *l
+	lp.GOOS = p.GOOS
+	lp.GOARCH = p.GOARCH
+	lp.Tags = append(append([]string(nil), l.Tags...), p.Tags...)
+	lp.AllowErrors = true
+
+	pkgs, err := lp.LoadContext(ctx, patterns...)
+	var loadErr *LoadError
+	if errors.As(err, &loadErr) {
+		err = nil
+	}
+
+	return pkgs, err
+}
+
+// merge merges the packages loaded for each platform.
+func merge(platforms []Platform, results [][]*Package) *Matrix {
+	index := make(map[string]*MatrixPackage)
+	for i, pkgs := range results {
+		p := platforms[i]
+		for _, pkg := range pkgs {
+			mp := index[pkg.ImportPath]
+			if mp == nil {
+				mp = &MatrixPackage{
+					ImportPath: pkg.ImportPath,
+					Packages:   make([]*Package, len(platforms)),
+					Files:      make(map[string][]Platform),
+				}
+				index[pkg.ImportPath] = mp
+			}
+			mp.Packages[i] = pkg
+
+			files := sources(pkg)
+			if len(files) > 0 {
+				mp.Platforms = append(mp.Platforms, p)
+			}
+			for _, name := range files {
+				mp.Files[name] = append(mp.Files[name], p)
+			}
+			for _, name := range pkg.IgnoredGoFiles {
+				if _, ok := mp.Files[name]; !ok {
+					mp.Files[name] = nil
+				}
+			}
+		}
+	}
+
+	m := &Matrix{
+		Platforms: platforms,
+		Packages:  make([]*MatrixPackage, 0, len(index)),
+	}
+	for _, mp := range index {
+		m.Packages = append(m.Packages, mp)
+	}
+	sort.Slice(m.Packages, func(i, j int) bool {
+		return m.Packages[i].ImportPath < m.Packages[j].ImportPath
+	})
+
+	return m
+}
+
+// sources returns all the source files of pkg, excluding the ignored ones.
+func sources(pkg *Package) []string {
+	lists := [][]string{
+		pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.MFiles,
+		pkg.HFiles, pkg.FFiles, pkg.SFiles, pkg.SwigFiles, pkg.SwigCXXFiles,
+		pkg.SysoFiles, pkg.TestGoFiles, pkg.XTestGoFiles,
+	}
+
+	var buf []string
+	for _, list := range lists {
+		buf = append(buf, list...)
+	}
+
+	return buf
+}
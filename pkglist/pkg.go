@@ -5,6 +5,10 @@
 package pkglist
 
 import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
 	"github.com/perillo/gocmd/modlist"
 )
 
@@ -77,18 +81,108 @@ type Package struct {
 	Incomplete bool            `json:",omitempty"` // this package or a dependency has an error
 	Error      *PackageError   `json:",omitempty"` // error loading package
 	DepsErrors []*PackageError `json:",omitempty"` // errors loading dependencies
+
+	// Toolchain information, not reported by go list
+	Toolchain string `json:",omitempty"` // version of the Go toolchain that loaded this package, if known
+}
+
+// PkgPath returns the import path of pkg without the test variant suffix, as
+// in "p" for the test variant "p [p.test]".
+func (p *Package) PkgPath() string {
+	if i := strings.Index(p.ImportPath, " ["); i >= 0 {
+		return p.ImportPath[:i]
+	}
+
+	return p.ImportPath
+}
+
+// IsTestVariant reports whether pkg is a test variant of a package, that is a
+// package compiled only for use in a test binary, as in "p [p.test]".
+//
+// The external test package of p, as in "p_test [p.test]", is not a test
+// variant, since it is not a copy of a non test package.
+func (p *Package) IsTestVariant() bool {
+	if !strings.HasSuffix(p.ImportPath, ".test]") {
+		return false
+	}
+
+	return p.PkgPath() != p.ForTest+"_test"
+}
+
+// IsTestMain reports whether pkg is the generated main package of a test
+// binary, as in "p.test".
+func (p *Package) IsTestMain() bool {
+	return p.Name == "main" && strings.HasSuffix(p.ImportPath, ".test") &&
+		!strings.Contains(p.ImportPath, " [")
 }
 
 // PackageError represents a package error.
+//
+// The Filename, Line and Column fields are parsed from Pos; Filename is an
+// absolute path.
 type PackageError struct {
 	ImportStack []string // shortest path from package named on command line to this one
 	Pos         string   // position of error (if present, file:line:col)
 	Err         string   // the error itself
+
+	// Position information, not reported by go list
+	Filename string `json:",omitempty"` // file name (if present)
+	Line     int    `json:",omitempty"` // line number, starting at 1 (if present)
+	Column   int    `json:",omitempty"` // column number, starting at 1 (if present)
 }
 
+// Error implements the error interface.
 func (pe *PackageError) Error() string {
 	return pe.Err
 }
 
+// String returns the error with its position, if present.
+func (pe *PackageError) String() string {
+	if pe.Pos == "" {
+		return pe.Err
+	}
+
+	return pe.Pos + ": " + pe.Err
+}
+
+// setPosition parses Pos, and sets the Filename, Line and Column fields.
+// Relative file names are resolved using dir.
+func (pe *PackageError) setPosition(dir string) {
+	pe.Filename, pe.Line, pe.Column = parsePos(pe.Pos)
+	if pe.Filename != "" && !filepath.IsAbs(pe.Filename) {
+		pe.Filename = filepath.Join(dir, pe.Filename)
+	}
+}
+
+// parsePos parses a position in the form file:line:col or file:line.
+func parsePos(pos string) (filename string, line, col int) {
+	// Parse from the end, since the file name may contain a colon.
+	n, rest := lastNumber(pos)
+	if rest == pos {
+		return pos, 0, 0
+	}
+	m, rest2 := lastNumber(rest)
+	if rest2 == rest {
+		return rest, n, 0
+	}
+
+	return rest2, m, n
+}
+
+// lastNumber parses the last :n component of s, and returns n and the rest
+// of s.  If s does not end with a :n component, lastNumber returns 0 and s.
+func lastNumber(s string) (int, string) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return 0, s
+	}
+	n, err := strconv.Atoi(s[i+1:])
+	if err != nil || n <= 0 {
+		return 0, s
+	}
+
+	return n, s[:i]
+}
+
 // Module represents a module.
 type Module = modlist.Module
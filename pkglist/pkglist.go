@@ -10,16 +10,41 @@ package pkglist
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
 )
 
 // Error is returned by Load in case the go command returns an error.
 type Error = invoke.Error
 
+// LoadError is returned by Load, when the AllowErrors option is set, in case
+// one or more packages have errors.
+type LoadError struct {
+	Packages []*Package // packages with errors
+}
+
+// Error implements the error interface.
+func (e *LoadError) Error() string {
+	buf := make([]string, 0, len(e.Packages))
+	for _, pkg := range e.Packages {
+		err := pkg.Error
+		if err == nil {
+			err = pkg.DepsErrors[0]
+		}
+		buf = append(buf, pkg.ImportPath+": "+err.String())
+	}
+
+	return fmt.Sprintf("%d packages with errors: %s", len(e.Packages), strings.Join(buf, "; "))
+}
+
 // Loader is used to provide custom options for loading packages.
 type Loader struct {
 	// Dir is the directory in which to run the go list command.
@@ -29,23 +54,114 @@ type Loader struct {
 	// Env is the environment to use when invoking go list.
 	// If Env is nil, the current environment is used.
 	Env []string
+
+	// Runner is the runner used to run the go list command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go list command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+
+	// ResolveToolchain, when true and Toolchain is nil, causes go env
+	// GOVERSION to be run too, so that the Toolchain field of each package
+	// records the version of the go command in $PATH, or of the one selected
+	// by GOTOOLCHAIN.
+	ResolveToolchain bool
+
+	// AllowErrors, when true, causes go list to be run with the -e flag, so
+	// that packages with errors are returned instead of causing Load to
+	// fail.  The errors are reported in the Error and DepsErrors fields of
+	// each package.
+	AllowErrors bool
+
+	// Deps, when true, causes go list to be run with the -deps flag, so that
+	// all the dependencies of the named packages are returned, in a
+	// depth-first post-order traversal.
+	Deps bool
+
+	// Test, when true, causes go list to be run with the -test flag, so that
+	// the test variants of the named packages, and the generated test main
+	// packages, are returned.  See Package.PkgPath and Package.IsTestMain.
+	Test bool
+
+	// Find, when true, causes go list to be run with the -find flag, so that
+	// the dependency information is not resolved.  Find can not be used with
+	// Deps, Test and Export.
+	Find bool
+
+	// Compiled, when true, causes go list to be run with the -compiled flag,
+	// so that CompiledGoFiles is set, including the files generated by cgo.
+	Compiled bool
+
+	// Export, when true, causes go list to be run with the -export flag, so
+	// that Export is set to the file containing the export data.
+	Export bool
+
+	// Tags is the list of additional build tags to consider satisfied, as in
+	// the -tags flag.
+	Tags []string
+
+	// GOOS and GOARCH are the target operating system and architecture.  If
+	// empty, the values from Env are used.
+	GOOS   string
+	GOARCH string
+
+	// GOWORK is the go.work file to use, by setting GOWORK.  It can be set to
+	// "off" to disable workspace mode.  If empty, the value from Env is used.
+	GOWORK string
+
+	// Cgo specifies whether cgo is enabled, by setting CGO_ENABLED.
+	Cgo CgoMode
+
+	// Mod is the module download mode, as in the -mod flag: "mod",
+	// "readonly" or "vendor".  If empty, the go command default is used.
+	Mod string
+
+	// ModFile is an alternate go.mod file, as in the -modfile flag.
+	ModFile string
+
+	// Trimpath, when true, causes go list to be run with the -trimpath flag.
+	Trimpath bool
 }
 
+// CgoMode specifies whether cgo is enabled.
+type CgoMode int
+
+// Values for CgoMode.
+const (
+	CgoDefault  CgoMode = iota // use CGO_ENABLED from Env, or the default
+	CgoEnabled                 // CGO_ENABLED=1
+	CgoDisabled                // CGO_ENABLED=0
+)
+
 // Load loads and returns the Go packages named by the given patterns.
 // The patterns are the same as the ones used by go list.
 //
 // If one or more packages cannot be loaded, Load returns a nil slice and an
 // error of type *Error.  If Load returns successfully, the returned packages
 // have all been correctly loaded.
+//
+// When AllowErrors is true, Load returns all the packages, including the ones
+// that cannot be loaded.  If one or more packages have errors, the error will
+// be of type *LoadError.  An error of type *Error is still returned if the go
+// command fails.
 func (l *Loader) Load(patterns ...string) ([]*Package, error) {
-	attr := invoke.Attr{
-		Dir: l.Dir,
-		Env: l.Env,
-	}
-	argv := []string{"-json"} // note no -e flag for now
+	return l.LoadContext(context.Background(), patterns...)
+}
+
+// LoadContext is like Load but includes a context.
+//
+// If the context is done before loading completes, the go list command is
+// killed and LoadContext returns a nil slice and an error of type *Error that
+// wraps ctx.Err().
+func (l *Loader) LoadContext(ctx context.Context, patterns ...string) ([]*Package, error) {
+	attr := l.attr()
+	argv := []string{"-json"}
+	argv = append(argv, l.flags()...)
 	argv = append(argv, patterns...)
 
-	stdout, err := invoke.Go("list", argv, &attr)
+	stdout, err := invoke.GoContext(ctx, "list", argv, &attr)
 	if err != nil {
 		return nil, fmt.Errorf("pkglist: load: %w", err)
 	}
@@ -53,6 +169,16 @@ func (l *Loader) Load(patterns ...string) ([]*Package, error) {
 	if err != nil {
 		return nil, fmt.Errorf("pkglist: load: %w", err)
 	}
+	if v := invoke.Version(ctx, &attr, l.ResolveToolchain); v != "" {
+		for _, pkg := range pkglist {
+			pkg.Toolchain = v
+		}
+	}
+	if l.AllowErrors {
+		if err := check(pkglist, l.Dir); err != nil {
+			return pkglist, fmt.Errorf("pkglist: load: %w", err)
+		}
+	}
 
 	return pkglist, nil
 }
@@ -70,6 +196,103 @@ func Load(patterns ...string) ([]*Package, error) {
 	return l.Load(patterns...)
 }
 
+// attr returns the attributes used to invoke go list.
+func (l *Loader) attr() invoke.Attr {
+	return invoke.Attr{
+		Dir:       l.Dir,
+		Env:       l.environ(),
+		Runner:    l.Runner,
+		Toolchain: l.Toolchain,
+	}
+}
+
+// flags returns the go list flags corresponding to the loader options.
+func (l *Loader) flags() []string {
+	var buf []string
+	add := func(set bool, flag string) {
+		if set {
+			buf = append(buf, flag)
+		}
+	}
+	add(l.AllowErrors, "-e")
+	add(l.Deps, "-deps")
+	add(l.Test, "-test")
+	add(l.Find, "-find")
+	add(l.Compiled, "-compiled")
+	add(l.Export, "-export")
+	add(len(l.Tags) > 0, "-tags="+strings.Join(l.Tags, ","))
+	add(l.Mod != "", "-mod="+l.Mod)
+	add(l.ModFile != "", "-modfile="+l.ModFile)
+	add(l.Trimpath, "-trimpath")
+
+	return buf
+}
+
+// environ returns the environment corresponding to the loader options.
+func (l *Loader) environ() []string {
+	env := l.Env
+	if l.GOOS != "" {
+		env = invoke.Setenv(env, "GOOS", l.GOOS)
+	}
+	if l.GOARCH != "" {
+		env = invoke.Setenv(env, "GOARCH", l.GOARCH)
+	}
+	if l.GOWORK != "" {
+		env = invoke.Setenv(env, "GOWORK", l.GOWORK)
+	}
+	switch l.Cgo {
+	case CgoEnabled:
+		env = invoke.Setenv(env, "CGO_ENABLED", "1")
+	case CgoDisabled:
+		env = invoke.Setenv(env, "CGO_ENABLED", "0")
+	}
+
+	return env
+}
+
+// check sets the position of all the package errors, using dir to resolve
+// relative file names, and returns an error of type *LoadError if one or more
+// packages have errors.
+func check(pkglist []*Package, dir string) error {
+	dir = absdir(dir)
+
+	var broken []*Package
+	for _, pkg := range pkglist {
+		if !checkPackage(pkg, dir) {
+			broken = append(broken, pkg)
+		}
+	}
+	if broken == nil {
+		return nil
+	}
+
+	return &LoadError{Packages: broken}
+}
+
+// checkPackage sets the position of the pkg errors, using the absolute dir to
+// resolve relative file names, and reports whether pkg has no errors.
+func checkPackage(pkg *Package, dir string) bool {
+	if pkg.Error != nil {
+		pkg.Error.setPosition(dir)
+	}
+	for _, err := range pkg.DepsErrors {
+		err.setPosition(dir)
+	}
+
+	return pkg.Error == nil && len(pkg.DepsErrors) == 0
+}
+
+// absdir returns the absolute path of the directory in which go list is run.
+func absdir(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	// Ignore the error, since in this case go list would have failed.
+	cwd, _ := os.Getwd()
+
+	return filepath.Join(cwd, dir)
+}
+
 func decode(data []byte) ([]*Package, error) {
 	pkglist := make([]*Package, 0, 10)
 	buf := bytes.NewBuffer(data)
@@ -87,10 +310,13 @@ func decode(data []byte) ([]*Package, error) {
 }
 
 // normalize ensures all the source file paths are absolute, for consistency.
+//
+// The files generated when using the -compiled and -test flags, as an example
+// the test main of a test binary, are already absolute paths into $GOCACHE.
 func normalize(pkg *Package) *Package {
 	abspaths(pkg.Dir, pkg.GoFiles)
 	abspaths(pkg.Dir, pkg.CgoFiles)
-	//abspaths(pkg.Dir, pkg.CompiledGoFiles)
+	abspaths(pkg.Dir, pkg.CompiledGoFiles)
 	abspaths(pkg.Dir, pkg.IgnoredGoFiles)
 	abspaths(pkg.Dir, pkg.CFiles)
 	abspaths(pkg.Dir, pkg.CXXFiles)
@@ -109,6 +335,9 @@ func normalize(pkg *Package) *Package {
 
 func abspaths(dir string, names []string) []string {
 	for i, name := range names {
+		if filepath.IsAbs(name) {
+			continue
+		}
 		path := filepath.Join(dir, name)
 		names[i] = path
 	}
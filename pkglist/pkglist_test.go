@@ -5,10 +5,19 @@
 package pkglist
 
 import (
+	"context"
 	"errors"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/perillo/gocmd/internal/modtest"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
 )
 
 // TestLoad tests that the Load function works correctly.
@@ -45,13 +54,619 @@ func TestLoadFail(t *testing.T) {
 	if pkgs != nil {
 		t.Errorf("expected the data to be nil, got %v", pkgs)
 	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("expected an error wrapping *exec.ExitError, got %v", err)
+	}
 
 	// TODO(mperillo): Ensure that the test is not brittle.
 	err = errors.Unwrap(err)
 	stderr := string(err.(*Error).Stderr)
-	pattern := "package xxx: malformed module path"
+	pattern := "package xxx"
 
 	if !strings.Contains(stderr, pattern) {
 		t.Errorf("stderr does not contain pattern %q, got %q", pattern, stderr)
 	}
 }
+
+// TestLoadContextCanceled tests that the LoadContext method returns an error
+// wrapping context.Canceled when the context is canceled.
+func TestLoadContextCanceled(t *testing.T) {
+	l := Loader{
+		Dir: os.TempDir(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pkgs, err := l.LoadContext(ctx, "flag")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if pkgs != nil {
+		t.Errorf("expected the data to be nil, got %v", pkgs)
+	}
+}
+
+// TestLoadRunner tests that the Load function uses the custom runner.
+func TestLoadRunner(t *testing.T) {
+	const stdout = `{"Dir": "/src/flag", "ImportPath": "flag", "Name": "flag", "GoFiles": ["flag.go"]}`
+	var argv []string
+	l := Loader{
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			argv = inv.Argv
+			res := &runner.Result{
+				Stdout: []byte(stdout),
+			}
+
+			return res, nil
+		}),
+	}
+
+	pkgs, err := l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"list", "-json", "flag"}; !reflect.DeepEqual(argv, want) {
+		t.Errorf("runner: got argv %q, want %q", argv, want)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("load: expected 1, got %d packages", len(pkgs))
+	}
+	if got, want := pkgs[0].GoFiles[0], filepath.Join("/src/flag", "flag.go"); got != want {
+		t.Errorf("load: got %q, want %q", got, want)
+	}
+}
+
+// TestLoadRunnerFail tests that the Load function reports a non 0 exit status
+// from a custom runner as an error of type *Error.
+func TestLoadRunnerFail(t *testing.T) {
+	const stderr = "package xxx is not in std"
+	l := Loader{
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			res := &runner.Result{
+				Stderr:   []byte(stderr),
+				ExitCode: 1,
+			}
+
+			return res, nil
+		}),
+	}
+
+	pkgs, err := l.Load("xxx")
+	if pkgs != nil {
+		t.Errorf("expected the data to be nil, got %v", pkgs)
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an error of type *Error, got %v", err)
+	}
+	if string(e.Stderr) != stderr {
+		t.Errorf("stderr: got %q, want %q", e.Stderr, stderr)
+	}
+	var exitErr *runner.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 1 {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+}
+
+// TestLoadToolchain tests that the Load function records the toolchain used
+// to load the packages, and that the toolchain GOROOT is used.
+func TestLoadToolchain(t *testing.T) {
+	tc, err := toolchain.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Loader{
+		Dir:       os.TempDir(),
+		Env:       append(os.Environ(), "GOROOT="+os.TempDir()),
+		Toolchain: tc,
+	}
+
+	pkgs, err := l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pkgs[0].Toolchain; got != tc.Version {
+		t.Errorf("load: got toolchain %q, want %q", got, tc.Version)
+	}
+	if want := filepath.Join(tc.GOROOT, "src", "flag"); pkgs[0].Dir != want {
+		t.Errorf("load: got dir %q, want %q", pkgs[0].Dir, want)
+	}
+
+	// The go command in $PATH is only recorded with ResolveToolchain.
+	l = Loader{
+		Dir: os.TempDir(),
+	}
+	pkgs, err = l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pkgs[0].Toolchain; got != "" {
+		t.Errorf("load: got toolchain %q, want none", got)
+	}
+	l.ResolveToolchain = true
+	pkgs, err = l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pkgs[0].Toolchain; got != tc.Version {
+		t.Errorf("load: got toolchain %q, want %q", got, tc.Version)
+	}
+}
+
+// TestLoadResolveToolchain tests that the Load function, with the
+// ResolveToolchain option set, gets the toolchain version from the custom
+// runner, and that go env GOVERSION is only run with the option set.
+func TestLoadResolveToolchain(t *testing.T) {
+	var calls [][]string
+	l := Loader{
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			calls = append(calls, inv.Argv)
+			res := new(runner.Result)
+			if inv.Argv[0] == "env" {
+				res.Stdout = []byte("go1.21.0\n")
+			} else {
+				res.Stdout = []byte(`{"ImportPath": "flag"}`)
+			}
+
+			return res, nil
+		}),
+	}
+
+	pkgs, err := l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || pkgs[0].Toolchain != "" {
+		t.Errorf("load: got calls %q and toolchain %q", calls, pkgs[0].Toolchain)
+	}
+
+	calls = nil
+	l.ResolveToolchain = true
+	pkgs, err = l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"env", "GOVERSION"}; len(calls) != 2 || !reflect.DeepEqual(calls[1], want) {
+		t.Errorf("runner: got calls %q, want %q last", calls, want)
+	}
+	if got := pkgs[0].Toolchain; got != "go1.21.0" {
+		t.Errorf("load: got toolchain %q, want %q", got, "go1.21.0")
+	}
+}
+
+// TestLoadAllowErrors tests that the Load function, with the AllowErrors
+// option set, returns all the packages and reports the packages with errors.
+func TestLoadAllowErrors(t *testing.T) {
+	dir := modtest.NewModule(t, map[string]string{
+		"go.mod":     "module example.com/bad\n",
+		"bad.go":     "package bad\n\nimport (\n\t\"fmt\n",
+		"sub/sub.go": "package sub\n\nimport _ \"example.com/bad\"\n",
+		"ok/ok.go":   "package ok\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := Loader{
+		Dir:         dir,
+		AllowErrors: true,
+	}
+	pkgs, err := l.Load("./...")
+	if len(pkgs) != 3 {
+		t.Fatalf("load: expected 3, got %d packages", len(pkgs))
+	}
+	var e *LoadError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an error of type *LoadError, got %v", err)
+	}
+	if len(e.Packages) != 2 {
+		t.Fatalf("load: expected 2, got %d packages with errors", len(e.Packages))
+	}
+
+	pkg := e.Packages[0]
+	if pkg.ImportPath != "example.com/bad" {
+		t.Fatalf("load: got %q, want %q", pkg.ImportPath, "example.com/bad")
+	}
+	want := filepath.Join(dir, "bad.go")
+	if got := pkg.Error.Filename; got != want {
+		t.Errorf("error: got filename %q, want %q", got, want)
+	}
+	if got := pkg.Error.Line; got != 4 {
+		t.Errorf("error: got line %d, want %d", got, 4)
+	}
+	if got := e.Packages[1].DepsErrors[0].Filename; got != want {
+		t.Errorf("deps error: got filename %q, want %q", got, want)
+	}
+}
+
+// TestParsePos tests the parsePos function.
+func TestParsePos(t *testing.T) {
+	var tests = []struct {
+		pos       string
+		filename  string
+		line, col int
+	}{
+		{"", "", 0, 0},
+		{"bad.go", "bad.go", 0, 0},
+		{"bad.go:4", "bad.go", 4, 0},
+		{"bad.go:4:2", "bad.go", 4, 2},
+		{`C:\src\bad.go:4:2`, `C:\src\bad.go`, 4, 2},
+	}
+
+	for _, test := range tests {
+		filename, line, col := parsePos(test.pos)
+		if filename != test.filename || line != test.line || col != test.col {
+			t.Errorf("parsePos(%q): got %q, %d, %d, want %q, %d, %d", test.pos,
+				filename, line, col, test.filename, test.line, test.col)
+		}
+	}
+}
+
+// TestLoadDeps tests the Load function with the Deps and Export options.
+func TestLoadDeps(t *testing.T) {
+	l := Loader{
+		Dir:    os.TempDir(),
+		Deps:   true,
+		Export: true,
+	}
+
+	pkgs, err := l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The packages are in depth-first post-order.
+	if got := pkgs[len(pkgs)-1].ImportPath; got != "flag" {
+		t.Errorf("load: expected flag as the last package, got %q", got)
+	}
+	for _, pkg := range pkgs {
+		if pkg.ImportPath == "unsafe" {
+			// unsafe has no export data.
+			continue
+		}
+		if !filepath.IsAbs(pkg.Export) {
+			t.Errorf("load %s: expected absolute export path, got %q", pkg.ImportPath, pkg.Export)
+		}
+	}
+}
+
+// TestLoadTest tests the Load function with the Test and Compiled options.
+func TestLoadTest(t *testing.T) {
+	dir := modtest.NewModule(t, map[string]string{
+		"go.mod":    "module example.com/m\n",
+		"m.go":      "package m\n",
+		"m_test.go": "package m\n",
+		"x_test.go": "package m_test\n\nimport _ \"example.com/m\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := Loader{
+		Dir:      dir,
+		Test:     true,
+		Compiled: true,
+	}
+	pkgs, err := l.Load(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, pkg := range pkgs {
+		kind := "package"
+		switch {
+		case pkg.IsTestMain():
+			kind = "main"
+		case pkg.IsTestVariant():
+			kind = "variant"
+		}
+		got = append(got, kind+" "+pkg.PkgPath())
+
+		for _, name := range append(pkg.GoFiles, pkg.CompiledGoFiles...) {
+			if !filepath.IsAbs(name) {
+				t.Errorf("load %s: expected absolute path, got %q", pkg.ImportPath, name)
+			}
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("load %s: %v", pkg.ImportPath, err)
+			}
+		}
+	}
+	want := []string{
+		"package example.com/m",
+		"main example.com/m.test",
+		"variant example.com/m",
+		"package example.com/m_test",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("load: got %q, want %q", got, want)
+	}
+}
+
+// TestIsTestVariant tests the IsTestVariant and IsTestMain methods.
+func TestIsTestVariant(t *testing.T) {
+	var tests = []struct {
+		pkg     Package
+		variant bool
+		main    bool
+	}{
+		{Package{ImportPath: "p", Name: "p"}, false, false},
+		{Package{ImportPath: "p [p.test]", Name: "p", ForTest: "p"}, true, false},
+		{Package{ImportPath: "q [p.test]", Name: "q", ForTest: "p"}, true, false},
+		{Package{ImportPath: "q_test [p.test]", Name: "q_test", ForTest: "p"}, true, false},
+		{Package{ImportPath: "p_test [p.test]", Name: "p_test", ForTest: "p"}, false, false},
+		{Package{ImportPath: "p_test", Name: "p_test"}, false, false},
+		{Package{ImportPath: "p.test", Name: "main"}, false, true},
+	}
+
+	for _, test := range tests {
+		if got := test.pkg.IsTestVariant(); got != test.variant {
+			t.Errorf("IsTestVariant(%q): got %v, want %v", test.pkg.ImportPath, got, test.variant)
+		}
+		if got := test.pkg.IsTestMain(); got != test.main {
+			t.Errorf("IsTestMain(%q): got %v, want %v", test.pkg.ImportPath, got, test.main)
+		}
+	}
+}
+
+// TestLoadBuildContext tests the Load function with the Tags, GOOS, GOARCH
+// and Cgo options.
+func TestLoadBuildContext(t *testing.T) {
+	dir := modtest.NewModule(t, map[string]string{
+		"go.mod":       "module example.com/m\n",
+		"m_linux.go":   "package m\n",
+		"m_windows.go": "package m\n",
+		"m_arm64.go":   "package m\n",
+		"tag.go":       "// +build foo\n\npackage m\n",
+		"cgo.go":       "// +build cgo\n\npackage m\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := Loader{
+		Dir:    dir,
+		Tags:   []string{"foo"},
+		GOOS:   "windows",
+		GOARCH: "arm64",
+		Cgo:    CgoDisabled,
+	}
+	pkgs, err := l.Load(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, name := range pkgs[0].GoFiles {
+		got = append(got, filepath.Base(name))
+	}
+	want := []string{"m_arm64.go", "m_windows.go", "tag.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("load: got %q, want %q", got, want)
+	}
+}
+
+// TestFlags tests that the Loader options are translated into the correct
+// go list flags.
+func TestFlags(t *testing.T) {
+	l := Loader{
+		AllowErrors: true,
+		Tags:        []string{"a", "b"},
+		Mod:         "vendor",
+		ModFile:     "alt.mod",
+		Trimpath:    true,
+	}
+
+	want := []string{"-e", "-tags=a,b", "-mod=vendor", "-modfile=alt.mod", "-trimpath"}
+	if got := l.flags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("flags: got %q, want %q", got, want)
+	}
+}
+
+// TestLoadMatrix tests the LoadMatrix method.
+func TestLoadMatrix(t *testing.T) {
+	dir := modtest.NewModule(t, map[string]string{
+		"go.mod":           "module example.com/m\n",
+		"m.go":             "package m\n",
+		"m_linux.go":       "package m\n",
+		"never.go":         "// +build ignore\n\npackage m\n",
+		"win/w_windows.go": "package win\n",
+	})
+	defer os.RemoveAll(dir)
+
+	linux := Platform{GOOS: "linux", GOARCH: "amd64"}
+	windows := Platform{GOOS: "windows", GOARCH: "amd64"}
+	l := Loader{
+		Dir: dir,
+	}
+	m, err := l.LoadMatrix(context.Background(), []Platform{linux, windows}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Packages) != 2 {
+		t.Fatalf("load matrix: expected 2, got %d packages", len(m.Packages))
+	}
+
+	mp := m.Packages[0]
+	if want := []Platform{linux, windows}; !reflect.DeepEqual(mp.Platforms, want) {
+		t.Errorf("%s: got platforms %v, want %v", mp.ImportPath, mp.Platforms, want)
+	}
+	files := map[string][]Platform{
+		"m.go":       {linux, windows},
+		"m_linux.go": {linux},
+		"never.go":   nil,
+	}
+	for name, want := range files {
+		got, ok := mp.Files[filepath.Join(dir, name)]
+		if !ok {
+			t.Errorf("%s: missing file %s", mp.ImportPath, name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got platforms %v, want %v", name, got, want)
+		}
+	}
+
+	mp = m.Packages[1]
+	if want := []Platform{windows}; !reflect.DeepEqual(mp.Platforms, want) {
+		t.Errorf("%s: got platforms %v, want %v", mp.ImportPath, mp.Platforms, want)
+	}
+	// Packages excluded by build constraints do not match ./... patterns.
+	if mp.Packages[0] != nil {
+		t.Errorf("%s: expected no package for %v", mp.ImportPath, linux)
+	}
+}
+
+// TestPlatforms tests that the Platforms method returns the current platform.
+func TestPlatforms(t *testing.T) {
+	l := Loader{
+		Dir: os.TempDir(),
+	}
+	platforms, err := l.Platforms(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Platform{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH}
+	for _, p := range platforms {
+		if reflect.DeepEqual(p, want) {
+			return
+		}
+	}
+	t.Errorf("platforms: %v not found in %v", want, platforms)
+}
+
+// TestGraph tests the Graph type.
+func TestGraph(t *testing.T) {
+	pkgs := []*Package{
+		{ImportPath: "c", GoFiles: []string{"/src/c/c.go"}},
+		{ImportPath: "b", Imports: []string{"c"}},
+		{ImportPath: "a", Imports: []string{"b", "c", "missing"}},
+		{ImportPath: "c [c.test]", GoFiles: []string{"/src/c/c.go"}, Imports: []string{"d"}},
+		{ImportPath: "d", Imports: []string{"c"}, ImportMap: map[string]string{"c": "c [c.test]"}},
+	}
+	g := NewGraph(pkgs)
+
+	paths := func(pkgs []*Package) []string {
+		var buf []string
+		for _, pkg := range pkgs {
+			buf = append(buf, pkg.ImportPath)
+		}
+
+		return buf
+	}
+
+	if got, want := paths(g.Importers("c")), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("importers: got %q, want %q", got, want)
+	}
+	if got, want := paths(g.Imports("d")), []string{"c [c.test]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("imports: got %q, want %q", got, want)
+	}
+	if got, want := paths(g.ReverseDeps("c")), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reverse deps: got %q, want %q", got, want)
+	}
+	if got, want := g.ShortestPath("a", "c"), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shortest path: got %q, want %q", got, want)
+	}
+	if got := g.ShortestPath("c", "a"); got != nil {
+		t.Errorf("shortest path: expected nil, got %q", got)
+	}
+	want := []string{"a", "b", "c", "c [c.test]", "d"}
+	if got := paths(g.Affected("/src/c/c.go")); !reflect.DeepEqual(got, want) {
+		t.Errorf("affected: got %q, want %q", got, want)
+	}
+
+	cycles := g.Cycles()
+	if len(cycles) != 1 {
+		t.Fatalf("cycles: expected 1, got %d", len(cycles))
+	}
+	if got, want := paths(cycles[0]), []string{"c [c.test]", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cycles: got %q, want %q", got, want)
+	}
+	if _, err := g.Sort(); err == nil {
+		t.Error("sort: expected error")
+	}
+
+	// Sort the graph without the cycle.
+	g = NewGraph(pkgs[:3])
+	sorted, err := g.Sort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(sorted), []string{"c", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sort: got %q, want %q", got, want)
+	}
+}
+
+// TestStream tests that the Stream method returns the same packages as the
+// Load method.
+func TestStream(t *testing.T) {
+	l := Loader{
+		Dir:  os.TempDir(),
+		Deps: true,
+	}
+	pkgs, err := l.Load("flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*Package
+	fn := func(pkg *Package) error {
+		got = append(got, pkg)
+
+		return nil
+	}
+	if err := l.Stream(context.Background(), fn, "flag"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, pkgs) {
+		t.Errorf("stream: got %d packages, want %d", len(got), len(pkgs))
+	}
+}
+
+// TestStreamStop tests that the Stream method stops the go command and returns
+// the error returned by the callback.
+func TestStreamStop(t *testing.T) {
+	l := Loader{
+		Dir:  os.TempDir(),
+		Deps: true,
+	}
+	stop := errors.New("stop")
+
+	var n int
+	fn := func(pkg *Package) error {
+		n++
+
+		return stop
+	}
+	if err := l.Stream(context.Background(), fn, "std"); err != stop {
+		t.Errorf("stream: expected %v, got %v", stop, err)
+	}
+	if n != 1 {
+		t.Errorf("stream: expected 1 call, got %d", n)
+	}
+}
+
+// TestStreamRunner tests the Stream method with a runner that does not
+// support streaming, and a failing go command.
+func TestStreamRunner(t *testing.T) {
+	const stdout = `{"ImportPath": "a"} {"ImportPath": "b"}`
+	l := Loader{
+		Runner: runner.Func(func(ctx context.Context, inv *runner.Invocation) (*runner.Result, error) {
+			res := &runner.Result{
+				Stdout:   []byte(stdout),
+				ExitCode: 1,
+			}
+
+			return res, nil
+		}),
+	}
+
+	var got []string
+	fn := func(pkg *Package) error {
+		got = append(got, pkg.ImportPath)
+
+		return nil
+	}
+	err := l.Stream(context.Background(), fn, "a", "b")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Errorf("stream: expected an error of type *Error, got %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stream: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkglist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/perillo/gocmd/internal/invoke"
+)
+
+// Stream loads the Go packages named by the given patterns, like LoadContext,
+// but instead of returning all the packages at the end, it calls fn for each
+// package as soon as it is decoded from the go list output.  The go list
+// output is never entirely buffered in memory.
+//
+// The go command output is read only as fast as fn returns, so a slow fn will
+// block the go command.  If fn returns an error, Stream kills the go command
+// and returns the error as is.
+//
+// If one or more packages cannot be loaded, Stream returns an error of type
+// *Error, but fn may have already been called for the packages decoded before
+// the go command failed.  When AllowErrors is true and one or more packages
+// have errors, the error will be of type *LoadError.
+func (l *Loader) Stream(ctx context.Context, fn func(*Package) error, patterns ...string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	attr := l.attr()
+	argv := []string{"-json"}
+	argv = append(argv, l.flags()...)
+	argv = append(argv, patterns...)
+	version := invoke.Version(ctx, &attr, l.ResolveToolchain)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		// Report the error before closing the pipe, so that it is available
+		// as soon as the decoder reaches the end of the output.
+		done <- invoke.GoStream(ctx, "list", argv, &attr, pw)
+		pw.Close()
+	}()
+
+	dir := absdir(l.Dir)
+	var broken []*Package
+	stop := func(err error) error {
+		// Make sure the go command can no longer write on stdout, before
+		// killing it.
+		pr.CloseWithError(err)
+		cancel()
+		<-done
+
+		return err
+	}
+	for dec := json.NewDecoder(pr); ; {
+		pkg := new(Package)
+		if err := dec.Decode(pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			err = fmt.Errorf("pkglist: stream: JSON decode: %w", err)
+			select {
+			case gerr := <-done:
+				if gerr != nil {
+					// The go command failed, so the output was truncated.
+					return fmt.Errorf("pkglist: stream: %w", gerr)
+				}
+
+				return err
+			default:
+				return stop(err)
+			}
+		}
+
+		pkg = normalize(pkg)
+		pkg.Toolchain = version
+		if l.AllowErrors && !checkPackage(pkg, dir) {
+			broken = append(broken, pkg)
+		}
+		if err := fn(pkg); err != nil {
+			return stop(err)
+		}
+	}
+	if err := <-done; err != nil {
+		return fmt.Errorf("pkglist: stream: %w", err)
+	}
+	if broken != nil {
+		err := &LoadError{Packages: broken}
+
+		return fmt.Errorf("pkglist: stream: %w", err)
+	}
+
+	return nil
+}
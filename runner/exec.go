@@ -0,0 +1,160 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// waitDelay is how long run waits for the output of a killed go command to be
+// copied, before closing the pipes.
+const waitDelay = time.Second
+
+// Exec is the default Runner.  It runs the go command at Invocation.Path, or
+// the one found in $PATH, as a subprocess.
+//
+// If the context is done before the go command completes, the go command and
+// all the processes it started are killed, and Run returns ctx.Err().  On
+// systems without process groups, only the go command is killed; the
+// processes it started may continue to run after Run returns, but Run waits at
+// most one second for them to close the output.
+type Exec struct{}
+
+// Run implements the Runner interface.
+func (Exec) Run(ctx context.Context, inv *Invocation) (*Result, error) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	path := inv.Path
+	if path == "" {
+		path = "go"
+	}
+	cmd := exec.Command(path, inv.Argv...)
+	cmd.Dir = inv.Dir
+	cmd.Env = inv.Env
+
+	var w io.Writer = stdout
+	if inv.Stdout != nil {
+		w = inv.Stdout
+	}
+	err := run(ctx, cmd, w, stderr)
+	res := &Result{
+		Stderr: stderr.Bytes(),
+	}
+	if inv.Stdout == nil {
+		res.Stdout = stdout.Bytes()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		res.ExitErr = exitErr
+
+		return res, nil
+	}
+
+	return res, err
+}
+
+// run starts cmd, copies its output to stdout and stderr, and waits for it to
+// complete.  If ctx is done before cmd completes, run kills cmd and all its
+// children and returns ctx.Err().
+//
+// The pipes are created by run, instead of by exec.Cmd, so that they can be
+// closed when ctx is done: a child that has not been killed may keep them
+// open, and Wait would block until the child exits.
+func run(ctx context.Context, cmd *exec.Cmd, stdout, stderr io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	outr, outw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer outr.Close()
+	errr, errw, err := os.Pipe()
+	if err != nil {
+		outw.Close()
+
+		return err
+	}
+	defer errr.Close()
+
+	cmd.Stdout = outw
+	cmd.Stderr = errw
+	setpgid(cmd)
+	err = cmd.Start()
+	// The write ends are now owned by cmd.
+	outw.Close()
+	errw.Close()
+	if err != nil {
+		return err
+	}
+
+	copied := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(stdout, outr)
+		copied <- err
+	}()
+	go func() {
+		_, err := io.Copy(stderr, errr)
+		copied <- err
+	}()
+
+	// Since cmd.Stdout and cmd.Stderr are files, Wait returns as soon as the
+	// go command exits.
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var (
+		werr    error
+		stopped bool
+	)
+	select {
+	case werr = <-done:
+	case <-ctx.Done():
+		kill(cmd)
+		<-done
+		stopped = true
+	}
+
+	// Wait for the output to be copied.  When ctx is done and the pipes are
+	// still open after waitDelay, close them, so that the copy completes.
+	var cerr error
+	cancel := ctx.Done()
+	var timeout <-chan time.Time
+	for n := 0; n < 2; {
+		select {
+		case err := <-copied:
+			if cerr == nil {
+				cerr = err
+			}
+			n++
+		case <-cancel:
+			cancel = nil
+			timeout = time.After(waitDelay)
+		case <-timeout:
+			outr.Close()
+			errr.Close()
+			stopped = true
+		}
+	}
+	if stopped {
+		return ctx.Err()
+	}
+	if werr != nil {
+		return werr
+	}
+
+	return cerr
+}
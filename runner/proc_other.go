@@ -0,0 +1,22 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package runner
+
+import (
+	"os/exec"
+)
+
+// setpgid is a no-op on systems without process groups.
+func setpgid(cmd *exec.Cmd) {}
+
+// kill kills the started cmd.  On systems without process groups, only the
+// go command is killed; the processes it started are not, and they may keep
+// the pipes open until run closes them.
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package runner
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setpgid configures cmd to run in a new process group, so that the go
+// command and all the processes it starts can be killed together.
+func setpgid(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// kill kills the process group of the started cmd.
+func kill(cmd *exec.Cmd) {
+	// The process group ID is the same as the process ID, since cmd was
+	// started with Setpgid.
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
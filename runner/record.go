@@ -0,0 +1,264 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a recorded invocation of the go command.
+//
+// A transcript is a sequence of JSON encoded records.
+type Record struct {
+	Path     string        `json:",omitempty"` // path of the go command, if not from $PATH
+	Argv     []string      // arguments to the go command, including the verb
+	Dir      string        `json:",omitempty"` // working directory of the go command
+	Env      []string      `json:",omitempty"` // relevant environment entries (GO* and CGO_*)
+	Stdout   string        `json:",omitempty"` // the entire content of the go command stdout
+	Stderr   string        `json:",omitempty"` // the entire content of the go command stderr
+	ExitCode int           `json:",omitempty"` // the exit status of the go command
+	Error    string        `json:",omitempty"` // the error from the runner, if any
+	Duration time.Duration // time taken by the invocation
+}
+
+// Recorder is a Runner that records each invocation of the go command in a
+// transcript.
+//
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	r Runner
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder returns a new Recorder that uses r to run the go command and
+// writes the transcript to w.  If r is nil, Exec is used.
+//
+// Each record is written to w with a single call to w.Write, so that w can be
+// a file opened in append mode and shared by multiple processes.
+func NewRecorder(w io.Writer, r Runner) *Recorder {
+	if r == nil {
+		r = Exec{}
+	}
+
+	return &Recorder{r: r, w: w}
+}
+
+// Run implements the Runner interface.
+//
+// Errors writing the transcript are ignored, so that recording will never
+// change the result of an invocation.
+func (r *Recorder) Run(ctx context.Context, inv *Invocation) (*Result, error) {
+	// Capture the streamed stdout, if any.
+	var streamed bytes.Buffer
+	if inv.Stdout != nil {
+		tmp := *inv
+		tmp.Stdout = io.MultiWriter(inv.Stdout, &streamed)
+		inv = &tmp
+	}
+
+	start := time.Now()
+	res, err := r.r.Run(ctx, inv)
+	rec := &Record{
+		Path:     inv.Path,
+		Argv:     inv.Argv,
+		Dir:      inv.Dir,
+		Env:      relevant(inv.Env),
+		Duration: time.Since(start),
+	}
+	rec.Stdout = streamed.String()
+	if res != nil {
+		rec.Stdout += string(res.Stdout)
+		rec.Stderr = string(res.Stderr)
+		rec.ExitCode = res.ExitCode
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	data, _ := json.Marshal(rec)
+	data = append(data, '\n')
+	r.mu.Lock()
+	r.w.Write(data)
+	r.mu.Unlock()
+
+	return res, err
+}
+
+// Replayer is a Runner that serves each invocation of the go command from a
+// transcript, without running the go command.
+//
+// An invocation matches a record when they have the same arguments.  Records
+// with the same go command path, relevant environment and working directory
+// are preferred, and records are served in the order they were recorded.
+// When all the matching records have been served, the last one is served
+// again.
+//
+// A Replayer is safe for concurrent use.
+type Replayer struct {
+	mu      sync.Mutex
+	records []*Record
+	used    []bool
+}
+
+// NewReplayer returns a new Replayer that reads the transcript from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	var records []*Record
+	for dec := json.NewDecoder(r); dec.More(); {
+		rec := new(Record)
+		if err := dec.Decode(rec); err != nil {
+			return nil, fmt.Errorf("runner: transcript: JSON decode: %w", err)
+		}
+		records = append(records, rec)
+	}
+	rp := &Replayer{
+		records: records,
+		used:    make([]bool, len(records)),
+	}
+
+	return rp, nil
+}
+
+// Records returns the records in the transcript.
+func (r *Replayer) Records() []*Record {
+	return r.records
+}
+
+// Run implements the Runner interface.
+//
+// If no record matches inv, Run returns an error of type *NoRecordError.
+func (r *Replayer) Run(ctx context.Context, inv *Invocation) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rec := r.match(inv)
+	if rec == nil {
+		return nil, &NoRecordError{Argv: inv.Argv}
+	}
+
+	res := &Result{
+		Stdout:   []byte(rec.Stdout),
+		Stderr:   []byte(rec.Stderr),
+		ExitCode: rec.ExitCode,
+	}
+	switch rec.Error {
+	case "":
+		return res, nil
+	case context.Canceled.Error():
+		return res, context.Canceled
+	case context.DeadlineExceeded.Error():
+		return res, context.DeadlineExceeded
+	default:
+		return res, errors.New(rec.Error)
+	}
+}
+
+// passes are the criteria used to match the records, in decreasing order of
+// strictness.
+var passes = []struct {
+	sameEnv bool // same go command path and relevant environment
+	sameDir bool // same working directory
+}{
+	{true, true},
+	{true, false},
+	{false, true},
+	{false, false},
+}
+
+// match returns the record matching inv, or nil.
+//
+// The records are matched in passes of decreasing strictness; a looser pass
+// is only used when no record matches in the stricter ones, as an example
+// when the transcript was recorded with a different environment.
+func (r *Replayer) match(inv *Invocation) *Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	env := relevant(inv.Env)
+	for _, pass := range passes {
+		last := -1
+		for i, rec := range r.records {
+			if !reflect.DeepEqual(rec.Argv, inv.Argv) {
+				continue
+			}
+			if pass.sameEnv && (rec.Path != inv.Path || !sameSet(rec.Env, env)) {
+				continue
+			}
+			if pass.sameDir && rec.Dir != inv.Dir {
+				continue
+			}
+			if !r.used[i] {
+				r.used[i] = true
+
+				return rec
+			}
+			last = i
+		}
+		if last >= 0 {
+			// All the matching records have been served.
+			return r.records[last]
+		}
+	}
+
+	return nil
+}
+
+// NoRecordError is returned by Replayer.Run when no record in the transcript
+// matches the invocation.
+type NoRecordError struct {
+	Argv []string
+}
+
+// Error implements the error interface.
+func (e *NoRecordError) Error() string {
+	return "runner: no record for go " + strings.Join(e.Argv, " ")
+}
+
+// relevant returns the environment entries relevant to the go command.  If
+// env is nil, the current process's environment is used.
+//
+// The GOCMD* entries used by this module are not relevant.
+func relevant(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+
+	var buf []string
+	for _, ent := range env {
+		if strings.HasPrefix(ent, "GOCMD") {
+			continue
+		}
+		if strings.HasPrefix(ent, "GO") || strings.HasPrefix(ent, "CGO_") {
+			buf = append(buf, ent)
+		}
+	}
+
+	return buf
+}
+
+// sameSet reports whether x and y contain the same entries, in any order.
+func sameSet(x, y []string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	x = append([]string(nil), x...)
+	y = append([]string(nil), y...)
+	sort.Strings(x)
+	sort.Strings(y)
+
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package runner defines the interface used to run the go command.
+//
+// The default Runner runs the go command as a subprocess.  Custom runners
+// can be used to fake the go command, as an example in tests.
+package runner
+
+import (
+	"context"
+	"io"
+	"strconv"
+)
+
+// Invocation describes a single invocation of the go command.
+type Invocation struct {
+	// Path is the path of the go command to run.
+	// If Path is the empty string, the go command is searched in $PATH.
+	Path string
+
+	// Argv holds the arguments to the go command, including the verb, as in
+	// []string{"list", "-json", "flag"}.
+	Argv []string
+
+	// Dir specifies the working directory of the go command.
+	// If Dir is the empty string, the go command runs in the calling
+	// process's current directory.
+	Dir string
+
+	// Env specifies the environment of the go command.
+	// Each entry is of the form "key=value".
+	// If Env is nil, the go command uses the current process's environment.
+	Env []string
+
+	// Stdout, if not nil, is where the go command stdout is written as it is
+	// produced, in which case Result.Stdout should be nil.  A Runner that
+	// does not support streaming may ignore Stdout and return the entire
+	// content in Result.Stdout; the caller will then write it to Stdout.
+	Stdout io.Writer
+}
+
+// Result is the result of a completed invocation of the go command.
+type Result struct {
+	Stdout   []byte // the entire content of the go command stdout, unless streamed
+	Stderr   []byte // the entire content of the go command stderr
+	ExitCode int    // the exit status of the go command
+
+	// ExitErr, if not nil, is the original error reporting a non 0 exit
+	// status, as an example the *exec.ExitError from Exec.
+	ExitErr error
+}
+
+// Runner is the interface implemented by types that can run the go command.
+//
+// Run runs the go command described by inv and waits for it to complete.  A
+// non 0 exit status is not an error; Run returns an error only if the go
+// command could not be run or could not complete, as an example when ctx is
+// done.  In that case the returned Result, if not nil, contains the output
+// written before the failure.
+type Runner interface {
+	Run(ctx context.Context, inv *Invocation) (*Result, error)
+}
+
+// Func is an adapter to allow the use of ordinary functions as a Runner.
+type Func func(ctx context.Context, inv *Invocation) (*Result, error)
+
+// Run implements the Runner interface.
+func (f Func) Run(ctx context.Context, inv *Invocation) (*Result, error) {
+	return f(ctx, inv)
+}
+
+// ExitError reports a non 0 exit status of the go command.
+type ExitError struct {
+	ExitCode int
+	Err      error // the original error from Result.ExitErr, if any
+}
+
+// Error implements the error interface.
+func (e *ExitError) Error() string {
+	return "exit status " + strconv.Itoa(e.ExitCode)
+}
+
+// Unwrap implements the error unwrapping interface.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
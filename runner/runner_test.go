@@ -0,0 +1,239 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExec tests that the Exec runner works correctly.
+func TestExec(t *testing.T) {
+	inv := Invocation{
+		Argv: []string{"version"},
+	}
+
+	res, err := Exec{}.Run(context.Background(), &inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 0 {
+		t.Errorf("run: expected exit status 0, got %d", res.ExitCode)
+	}
+	const want = "go version "
+	if !bytes.HasPrefix(res.Stdout, []byte(want)) {
+		t.Errorf("run: expected stdout to start with %q, got %q", want, res.Stdout)
+	}
+}
+
+// TestExecFail tests that the Exec runner reports a non 0 exit status in
+// Result.ExitCode, and not as an error.
+func TestExecFail(t *testing.T) {
+	inv := Invocation{
+		Argv: []string{"xxx"},
+	}
+
+	res, err := Exec{}.Run(context.Background(), &inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode == 0 {
+		t.Error("run: expected a non 0 exit status")
+	}
+	if len(res.Stderr) == 0 {
+		t.Error("run: expected stderr to be not empty")
+	}
+	if _, ok := res.ExitErr.(*exec.ExitError); !ok {
+		t.Errorf("run: expected *exec.ExitError, got %v", res.ExitErr)
+	}
+}
+
+// TestExecCanceled tests that the Exec runner returns ctx.Err() when the
+// context is canceled.
+func TestExecCanceled(t *testing.T) {
+	inv := Invocation{
+		Argv: []string{"version"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := (Exec{}).Run(ctx, &inv); err != context.Canceled {
+		t.Errorf("run: expected context.Canceled, got %v", err)
+	}
+}
+
+// TestRunCanceledChild tests that the run function returns when the context
+// is done, even if a child not killed keeps the output open.
+func TestRunCanceledChild(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid not found")
+	}
+	// The sleep started with setsid is in a different process group, so it
+	// is not killed.
+	cmd := exec.Command("sh", "-c", "setsid sleep 5 & sleep 5")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var stdout, stderr bytes.Buffer
+	if err := run(ctx, cmd, &stdout, &stderr); err != context.DeadlineExceeded {
+		t.Errorf("run: expected context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > waitDelay+time.Second {
+		t.Errorf("run: expected to return after the wait delay, took %v", d)
+	}
+}
+
+// TestRecordReplay tests that the invocations recorded by a Recorder are
+// served by a Replayer.
+func TestRecordReplay(t *testing.T) {
+	var calls int
+	fake := Func(func(ctx context.Context, inv *Invocation) (*Result, error) {
+		calls++
+		res := &Result{
+			Stdout: []byte(strings.Join(inv.Argv, " ")),
+			Stderr: []byte(inv.Dir),
+		}
+		if inv.Argv[0] == "xxx" {
+			res.ExitCode = 2
+		}
+
+		return res, nil
+	})
+
+	invs := []*Invocation{
+		{Argv: []string{"list", "flag"}, Dir: "/a"},
+		{Argv: []string{"list", "flag"}, Dir: "/b"},
+		{Argv: []string{"xxx"}, Env: []string{"GOOS=linux", "HOME=/root"}},
+	}
+	transcript := new(bytes.Buffer)
+	rec := NewRecorder(transcript, fake)
+	var want []*Result
+	for _, inv := range invs {
+		res, err := rec.Run(context.Background(), inv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, res)
+	}
+
+	data := transcript.Bytes()
+	rp, err := NewReplayer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rp.Records()); n != len(invs) {
+		t.Fatalf("replay: expected %d, got %d records", len(invs), n)
+	}
+	if got, want := rp.Records()[2].Env, []string{"GOOS=linux"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("record: got env %q, want %q", got, want)
+	}
+
+	// Replay in reverse order, to check that the working directory is used
+	// for matching.
+	for i := len(invs) - 1; i >= 0; i-- {
+		got, err := rp.Run(context.Background(), invs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("replay %q: got %+v, want %+v", invs[i].Argv, got, want[i])
+		}
+	}
+	if calls != len(invs) {
+		t.Errorf("replay: expected %d calls to the runner, got %d", len(invs), calls)
+	}
+
+	// A record can be served again.
+	if got, err := rp.Run(context.Background(), invs[0]); err != nil {
+		t.Errorf("replay: expected no error, got %v", err)
+	} else if !reflect.DeepEqual(got, want[0]) {
+		t.Errorf("replay %q again: got %+v, want %+v", invs[0].Argv, got, want[0])
+	}
+
+	// A record in the same directory is served again, instead of an unused
+	// record in a different directory.
+	rp, err = NewReplayer(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := rp.Run(context.Background(), invs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Stdout) != "list flag" || string(got.Stderr) != "/a" {
+			t.Errorf("replay %d %q: got %+v, want %+v", i+1, invs[0].Argv, got, want[0])
+		}
+	}
+
+	inv := &Invocation{Argv: []string{"env"}}
+	if _, err := rp.Run(context.Background(), inv); err == nil {
+		t.Errorf("replay: expected error")
+	} else if _, ok := err.(*NoRecordError); !ok {
+		t.Errorf("replay: expected *NoRecordError, got %v", err)
+	}
+}
+
+// TestReplayEnv tests that a Replayer serves the record with the same
+// relevant environment, when the records have the same arguments.
+func TestReplayEnv(t *testing.T) {
+	fake := Func(func(ctx context.Context, inv *Invocation) (*Result, error) {
+		res := &Result{
+			Stdout: []byte(strings.Join(inv.Env, " ")),
+		}
+
+		return res, nil
+	})
+
+	invs := []*Invocation{
+		{Argv: []string{"list", "."}, Env: []string{"GOOS=linux", "GOARCH=amd64"}},
+		{Argv: []string{"list", "."}, Env: []string{"GOOS=windows", "GOARCH=amd64"}},
+	}
+	transcript := new(bytes.Buffer)
+	rec := NewRecorder(transcript, fake)
+	for _, inv := range invs {
+		if _, err := rec.Run(context.Background(), inv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rp, err := NewReplayer(transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay in reverse order, with the environment entries in a different
+	// order.
+	tests := []struct {
+		env  []string
+		want string
+	}{
+		{[]string{"GOARCH=amd64", "GOOS=windows"}, "GOOS=windows GOARCH=amd64"},
+		{[]string{"GOARCH=amd64", "GOOS=linux"}, "GOOS=linux GOARCH=amd64"},
+		{[]string{"GOARCH=amd64", "GOOS=windows"}, "GOOS=windows GOARCH=amd64"},
+	}
+	for _, test := range tests {
+		inv := &Invocation{Argv: []string{"list", "."}, Env: test.env}
+		got, err := rp.Run(context.Background(), inv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Stdout) != test.want {
+			t.Errorf("replay %q: got %q, want %q", test.env, got.Stdout, test.want)
+		}
+	}
+
+	// A record with a different environment is served when no record has the
+	// same environment.
+	inv := &Invocation{Argv: []string{"list", "."}, Env: []string{"GOOS=darwin"}}
+	if _, err := rp.Run(context.Background(), inv); err != nil {
+		t.Errorf("replay: expected no error, got %v", err)
+	}
+}
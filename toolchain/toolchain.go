@@ -0,0 +1,241 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package toolchain provides support for selecting a specific Go toolchain.
+package toolchain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/perillo/gocmd/runner"
+)
+
+// Toolchain represents an installed Go toolchain.
+type Toolchain struct {
+	Path    string // absolute path to the go command
+	GOROOT  string // root of the Go toolchain
+	Version string // toolchain version, as in go env GOVERSION
+}
+
+// String implements the Stringer interface.
+func (t *Toolchain) String() string {
+	return t.Version + " (" + t.GOROOT + ")"
+}
+
+// New returns the toolchain installed in goroot.
+//
+// The version is read from the $GOROOT/VERSION file; if the file does not
+// exist, as an example for a toolchain built from source, the go command is
+// invoked to get it.
+func New(goroot string) (*Toolchain, error) {
+	goroot, err := filepath.Abs(goroot)
+	if err != nil {
+		return nil, fmt.Errorf("toolchain: %w", err)
+	}
+	t := &Toolchain{
+		Path:   filepath.Join(goroot, "bin", "go"+exe()),
+		GOROOT: goroot,
+	}
+	if _, err := os.Stat(t.Path); err != nil {
+		return nil, fmt.Errorf("toolchain: %w", err)
+	}
+
+	version, err := readVersion(goroot)
+	if err != nil {
+		return FromPath(t.Path)
+	}
+	t.Version = version
+
+	return t, nil
+}
+
+// FromPath returns the toolchain of the go command at path.  The path can
+// also be a wrapper, like the ones installed by golang.org/dl.
+//
+// The go command is invoked to get the toolchain GOROOT and version.
+func FromPath(path string) (*Toolchain, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("toolchain: %w", err)
+	}
+	inv := runner.Invocation{
+		Path: path,
+		Argv: []string{"env", "GOROOT", "GOVERSION"},
+		Env:  append(os.Environ(), "GOTOOLCHAIN=local"),
+	}
+
+	res, err := runner.Exec{}.Run(context.Background(), &inv)
+	if err != nil {
+		return nil, fmt.Errorf("toolchain: %s: %w", path, err)
+	}
+	if res.ExitCode != 0 {
+		stderr := string(bytes.TrimSpace(res.Stderr))
+
+		return nil, fmt.Errorf("toolchain: %s: exit status %d: %s", path, res.ExitCode, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(string(res.Stdout)), "\n")
+	if len(lines) != 2 || lines[1] == "" {
+		// GOVERSION is only available since Go 1.16.
+		return nil, fmt.Errorf("toolchain: %s: unable to get GOVERSION", path)
+	}
+	t := &Toolchain{
+		Path:    path,
+		GOROOT:  lines[0],
+		Version: lines[1],
+	}
+
+	return t, nil
+}
+
+// Discover returns the toolchains installed in $HOME/sdk by golang.org/dl,
+// and the toolchains downloaded in the module cache when GOTOOLCHAIN selects
+// a toolchain different from the local one.  Only the toolchains for the
+// current GOOS and GOARCH are returned.
+//
+// The returned toolchains are sorted by version.
+func Discover() ([]*Toolchain, error) {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		matches, _ := filepath.Glob(filepath.Join(home, "sdk", "go*"))
+		dirs = append(dirs, matches...)
+	}
+	if modcache := gomodcache(); modcache != "" {
+		// See src/cmd/go/internal/toolchain/select.go.
+		suffix := "." + runtime.GOOS + "-" + runtime.GOARCH
+		pattern := filepath.Join(modcache, "golang.org", "toolchain@v0.0.1-go*"+suffix)
+		matches, _ := filepath.Glob(pattern)
+		dirs = append(dirs, matches...)
+	}
+
+	var buf []*Toolchain
+	for _, dir := range dirs {
+		t, err := New(dir)
+		if err != nil {
+			// Not a Go toolchain, or a partially downloaded one.
+			continue
+		}
+		buf = append(buf, t)
+	}
+	sort.SliceStable(buf, func(i, j int) bool {
+		return compare(buf[i].Version, buf[j].Version) < 0
+	})
+
+	return buf, nil
+}
+
+// Default returns the go command in $PATH.
+func Default() (*Toolchain, error) {
+	return FromPath(goPath())
+}
+
+// readVersion reads the toolchain version from the $GOROOT/VERSION file.
+func readVersion(goroot string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(goroot, "VERSION"))
+	if err != nil {
+		return "", err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() || !strings.HasPrefix(sc.Text(), "go") {
+		return "", fmt.Errorf("%s: invalid VERSION file", goroot)
+	}
+
+	return sc.Text(), nil
+}
+
+// gomodcache returns the module cache directory, or an empty string if it is
+// not available.
+func gomodcache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	inv := runner.Invocation{
+		Argv: []string{"env", "GOMODCACHE"},
+	}
+	res, err := runner.Exec{}.Run(context.Background(), &inv)
+	if err != nil || res.ExitCode != 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(string(res.Stdout))
+}
+
+// goPath returns the absolute path of the go command in $PATH, or "go" if it
+// can not be found.
+func goPath() string {
+	path, err := exec.LookPath("go")
+	if err != nil {
+		return "go"
+	}
+
+	return path
+}
+
+func exe() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+
+	return ""
+}
+
+// compare compares two Go versions, like go1.21.3 and go1.22rc1.
+// Versions that can not be parsed sort before valid versions.
+func compare(x, y string) int {
+	vx, vy := parse(x), parse(y)
+	for i := range vx {
+		if vx[i] != vy[i] {
+			if vx[i] < vy[i] {
+				return -1
+			}
+
+			return +1
+		}
+	}
+
+	return 0
+}
+
+// parse parses a Go version into major, minor, patch, kind and pre-release
+// number, where kind is 0 for beta, 1 for rc and 2 for release.
+func parse(v string) [5]int {
+	var r [5]int
+	if !strings.HasPrefix(v, "go") {
+		r[0] = -1
+
+		return r
+	}
+	v = strings.TrimPrefix(v, "go")
+	if i := strings.IndexAny(v, " -"); i >= 0 {
+		v = v[:i] // as in "go1.22-devel"
+	}
+
+	r[3] = 2
+	for _, kind := range []string{"beta", "rc"} {
+		if i := strings.Index(v, kind); i >= 0 {
+			if kind == "beta" {
+				r[3] = 0
+			} else {
+				r[3] = 1
+			}
+			r[4], _ = strconv.Atoi(v[i+len(kind):])
+			v = v[:i]
+		}
+	}
+	for i, s := range strings.SplitN(v, ".", 3) {
+		r[i], _ = strconv.Atoi(s)
+	}
+
+	return r
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package toolchain
+
+import (
+	"testing"
+)
+
+// TestDefault tests that the Default and New functions return the same
+// toolchain.
+func TestDefault(t *testing.T) {
+	want, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := New(want.GOROOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != want.Version {
+		t.Errorf("new: got version %q, want %q", got.Version, want.Version)
+	}
+	if got.GOROOT != want.GOROOT {
+		t.Errorf("new: got GOROOT %q, want %q", got.GOROOT, want.GOROOT)
+	}
+}
+
+// TestNewFail tests that the New function fails when GOROOT does not contain
+// a go command.
+func TestNewFail(t *testing.T) {
+	if _, err := New("/nonexistent/goroot"); err == nil {
+		t.Error("new: expected error")
+	}
+}
+
+// TestCompare tests the compare function.
+func TestCompare(t *testing.T) {
+	var tests = []struct {
+		x, y string
+		want int
+	}{
+		{"go1.21.3", "go1.21.3", 0},
+		{"go1.21", "go1.21.0", 0},
+		{"go1.21.3", "go1.21.10", -1},
+		{"go1.22rc1", "go1.22.0", -1},
+		{"go1.22beta1", "go1.22rc1", -1},
+		{"go1.22rc2", "go1.22rc1", +1},
+		{"go1.9", "go1.10", -1},
+		{"xxx", "go1.0", -1},
+	}
+
+	for _, test := range tests {
+		if got := compare(test.x, test.y); got != test.want {
+			t.Errorf("compare(%q, %q): got %d, want %d", test.x, test.y, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workspace
+
+import (
+	"github.com/perillo/gocmd/internal/edit"
+	"github.com/perillo/gocmd/modedit"
+)
+
+// Edit is an editing operation, corresponding to one of the go work edit
+// editing flags.
+//
+// The go, toolchain, godebug and replace edits are shared with go mod edit:
+// use modedit.SetGo, modedit.SetToolchain, modedit.AddGodebug,
+// modedit.DropGodebug, modedit.AddReplace and modedit.DropReplace.
+type Edit = modedit.Edit
+
+// flags returns the go work edit flags corresponding to edits.
+func flags(edits []Edit) []string {
+	buf := make([]string, 0, len(edits))
+	for _, e := range edits {
+		buf = append(buf, e.String())
+	}
+
+	return buf
+}
+
+// AddUse adds a use directive for the module directory.
+func AddUse(dir string) Edit {
+	return edit.New("use", dir)
+}
+
+// DropUse drops the use directive for the module directory.
+func DropUse(dir string) Edit {
+	return edit.New("dropuse", dir)
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package workspace is a wrapper for the go work command.
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/perillo/gocmd/internal/invoke"
+	"github.com/perillo/gocmd/modedit"
+	"github.com/perillo/gocmd/runner"
+	"github.com/perillo/gocmd/toolchain"
+)
+
+// Error is returned in case the go command returns an error.
+type Error = invoke.Error
+
+// GoWork represents a go.work file, as reported by go work edit -json.
+type GoWork struct {
+	Go        string            // go directive
+	Toolchain string            // toolchain directive
+	Godebug   []modedit.Godebug // godebug directives
+	Use       []Use
+	Replace   []modedit.Replace
+}
+
+// Use is a use directive, adding a module to the workspace.
+type Use struct {
+	// DiskPath is the directory of the module, relative to the directory of
+	// the go.work file.
+	DiskPath string
+
+	// ModulePath is the path of the module, if present in the go.work file.
+	ModulePath string `json:"ModPath,omitempty"`
+}
+
+// Dir returns the absolute directory of the module, using file as the path of
+// the go.work file.
+func (u Use) Dir(file string) string {
+	if filepath.IsAbs(u.DiskPath) {
+		return filepath.Clean(u.DiskPath)
+	}
+
+	return filepath.Join(filepath.Dir(file), filepath.FromSlash(u.DiskPath))
+}
+
+// Editor is used to provide custom options for reading and editing a go.work
+// file.
+type Editor struct {
+	// Dir is the directory in which to run the go work command.
+	// If Dir is empty, go work is run in the current directory.
+	Dir string
+
+	// Env is the environment to use when invoking go work.
+	// If Env is nil, the current environment is used.
+	Env []string
+
+	// Runner is the runner used to run the go work command.
+	// If Runner is nil, the go command is run as a subprocess.
+	Runner runner.Runner
+
+	// Toolchain is the Go toolchain used to run the go work command.
+	// If Toolchain is nil, the go command in $PATH is used.
+	Toolchain *toolchain.Toolchain
+
+	// GOWORK is the go.work file to use, by setting GOWORK.  If empty, the
+	// value from Env is used, or the go.work file is searched in Dir and its
+	// parent directories.
+	GOWORK string
+}
+
+// File returns the path of the go.work file in use, or an empty string if
+// workspace mode is disabled.
+func (e *Editor) File() (string, error) {
+	return e.FileContext(context.Background())
+}
+
+// FileContext is like File but includes a context.
+func (e *Editor) FileContext(ctx context.Context) (string, error) {
+	stdout, err := invoke.GoContext(ctx, "env", []string{"GOWORK"}, e.attr())
+	if err != nil {
+		return "", fmt.Errorf("workspace: file: %w", err)
+	}
+	file := string(bytes.TrimSpace(stdout))
+	if file == "off" {
+		file = ""
+	}
+
+	return file, nil
+}
+
+// Load reads and returns the go.work file, with the specified edits applied.
+// The go.work file is not modified.
+//
+// If the go.work file cannot be loaded, Load returns a nil GoWork and an
+// error of type *Error.
+func (e *Editor) Load(edits ...Edit) (*GoWork, error) {
+	return e.LoadContext(context.Background(), edits...)
+}
+
+// LoadContext is like Load but includes a context.
+func (e *Editor) LoadContext(ctx context.Context, edits ...Edit) (*GoWork, error) {
+	argv := []string{"edit", "-json"}
+	argv = append(argv, flags(edits)...)
+	stdout, err := invoke.GoContext(ctx, "work", argv, e.attr())
+	if err != nil {
+		return nil, fmt.Errorf("workspace: load: %w", err)
+	}
+
+	gowork := new(GoWork)
+	if err := json.Unmarshal(stdout, gowork); err != nil {
+		return nil, fmt.Errorf("workspace: load: JSON unmarshal: %w", err)
+	}
+
+	return gowork, nil
+}
+
+// Apply applies the specified edits, in order, and writes the go.work file.
+//
+// If the go.work file cannot be edited, Apply returns an error of type *Error
+// and the go.work file is not modified.
+func (e *Editor) Apply(edits ...Edit) error {
+	return e.ApplyContext(context.Background(), edits...)
+}
+
+// ApplyContext is like Apply but includes a context.
+func (e *Editor) ApplyContext(ctx context.Context, edits ...Edit) error {
+	if len(edits) == 0 {
+		return nil
+	}
+	argv := []string{"edit"}
+	argv = append(argv, flags(edits)...)
+	if _, err := invoke.GoContext(ctx, "work", argv, e.attr()); err != nil {
+		return fmt.Errorf("workspace: apply: %w", err)
+	}
+
+	return nil
+}
+
+// Use adds the modules in the specified directories to the workspace, as in
+// go work use.  Directories that no longer exist are removed from the
+// workspace.
+func (e *Editor) Use(dirs ...string) error {
+	return e.UseContext(context.Background(), dirs...)
+}
+
+// UseContext is like Use but includes a context.
+func (e *Editor) UseContext(ctx context.Context, dirs ...string) error {
+	argv := append([]string{"use"}, dirs...)
+	if _, err := invoke.GoContext(ctx, "work", argv, e.attr()); err != nil {
+		return fmt.Errorf("workspace: use: %w", err)
+	}
+
+	return nil
+}
+
+// UseTree is like Use, but searches recursively for modules in the
+// specified directories, as in go work use -r.
+func (e *Editor) UseTree(dirs ...string) error {
+	return e.UseTreeContext(context.Background(), dirs...)
+}
+
+// UseTreeContext is like UseTree but includes a context.
+func (e *Editor) UseTreeContext(ctx context.Context, dirs ...string) error {
+	argv := append([]string{"use", "-r"}, dirs...)
+	if _, err := invoke.GoContext(ctx, "work", argv, e.attr()); err != nil {
+		return fmt.Errorf("workspace: use: %w", err)
+	}
+
+	return nil
+}
+
+// Sync syncs the workspace build list back to the workspace modules, as in
+// go work sync.
+func (e *Editor) Sync() error {
+	return e.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync but includes a context.
+func (e *Editor) SyncContext(ctx context.Context) error {
+	if _, err := invoke.GoContext(ctx, "work", []string{"sync"}, e.attr()); err != nil {
+		return fmt.Errorf("workspace: sync: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Editor) attr() *invoke.Attr {
+	env := e.Env
+	if e.GOWORK != "" {
+		env = invoke.Setenv(env, "GOWORK", e.GOWORK)
+	}
+	attr := invoke.Attr{
+		Dir:       e.Dir,
+		Env:       env,
+		Runner:    e.Runner,
+		Toolchain: e.Toolchain,
+	}
+
+	return &attr
+}
+
+// Load reads and returns the go.work file in use, using the default editor
+// configuration.
+//
+// If the go.work file cannot be loaded, Load returns a nil GoWork and an
+// error of type *Error.
+func Load() (*GoWork, error) {
+	var e Editor
+
+	return e.Load()
+}
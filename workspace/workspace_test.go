@@ -0,0 +1,168 @@
+// Copyright 2020 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/perillo/gocmd/internal/modtest"
+	"github.com/perillo/gocmd/modedit"
+)
+
+// mkworkspace creates a temporary workspace with the modules a and b, and an
+// additional module c not in the workspace.
+func mkworkspace(t *testing.T) string {
+	files := map[string]string{
+		"go.work":  "go 1.18\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod": "module example.com/a\n\ngo 1.18\n",
+		"b/go.mod": "module example.com/b\n\ngo 1.18\n",
+		"c/go.mod": "module example.com/c\n\ngo 1.18\n",
+	}
+
+	return modtest.NewModule(t, files)
+}
+
+// editor returns an editor for the workspace in dir.  GOFLAGS is cleared,
+// since -mod=mod is not allowed in workspace mode.
+func editor(dir string) *Editor {
+	e := &Editor{
+		Dir: filepath.Join(dir, "a"),
+		Env: append(os.Environ(), "GOFLAGS="),
+	}
+
+	return e
+}
+
+// TestFile tests the File method.
+func TestFile(t *testing.T) {
+	dir := mkworkspace(t)
+	defer os.RemoveAll(dir)
+
+	e := editor(dir)
+	file, err := e.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "go.work"); file != want {
+		t.Errorf("file: got %q, want %q", file, want)
+	}
+
+	e.GOWORK = "off"
+	file, err = e.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != "" {
+		t.Errorf("file: expected empty, got %q", file)
+	}
+}
+
+// TestLoad tests that the Load method decodes the go.work file.
+func TestLoad(t *testing.T) {
+	dir := mkworkspace(t)
+	defer os.RemoveAll(dir)
+
+	e := editor(dir)
+	got, err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &GoWork{
+		Go: "1.18",
+		Use: []Use{
+			{DiskPath: "./a"},
+			{DiskPath: "./b"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("load: got %+v, want %+v", got, want)
+	}
+	file := filepath.Join(dir, "go.work")
+	if got, want := got.Use[1].Dir(file), filepath.Join(dir, "b"); got != want {
+		t.Errorf("dir: got %q, want %q", got, want)
+	}
+}
+
+// TestLoadFail tests that the Load method, when not in workspace mode,
+// returns an error of type *Error.
+func TestLoadFail(t *testing.T) {
+	dir := mkworkspace(t)
+	defer os.RemoveAll(dir)
+
+	e := editor(dir)
+	e.GOWORK = "off"
+	if _, err := e.Load(); err == nil {
+		t.Fatal("expected an error")
+	} else {
+		var ee *Error
+		if !errors.As(err, &ee) {
+			t.Errorf("expected an error of type *Error, got %v", err)
+		}
+	}
+}
+
+// TestApply tests the Apply, Use and Sync methods.
+func TestApply(t *testing.T) {
+	dir := mkworkspace(t)
+	defer os.RemoveAll(dir)
+
+	e := editor(dir)
+	err := e.Apply(
+		DropUse("./b"),
+		modedit.AddReplace(modedit.Module{Path: "golang.org/x/text"}, modedit.Module{Path: "./text"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Use("../c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &GoWork{
+		Go: "1.18",
+		Use: []Use{
+			{DiskPath: "./a"},
+			{DiskPath: "./c"},
+		},
+		Replace: []modedit.Replace{
+			{
+				Old: modedit.Module{Path: "golang.org/x/text"},
+				New: modedit.Module{Path: "./text"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("load: got %+v, want %+v", got, want)
+	}
+}
+
+// TestUseTree tests the UseTree method.
+func TestUseTree(t *testing.T) {
+	dir := mkworkspace(t)
+	defer os.RemoveAll(dir)
+
+	e := editor(dir)
+	if err := e.UseTree(dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Use) != 3 {
+		t.Errorf("use: expected 3 modules, got %+v", got.Use)
+	}
+}